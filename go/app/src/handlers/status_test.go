@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go/dedup"
+	"github.com/ex10se/http-perf-test/go/idempotency"
+	"github.com/ex10se/http-perf-test/go/models"
+	"github.com/ex10se/http-perf-test/go/publisher"
+	"github.com/ex10se/http-perf-test/go/rabbitmq"
+)
+
+// events — запрос с обычным и системным событием
+const events = `[
+	{"txId": "tx-1", "state": "SUCCESS", "updatedAt": "2024-05-01T12:00:00Z"},
+	{"txId": "tx-2", "state": "FAILED", "updatedAt": "2024-05-01T12:00:01Z", "trackData": {"is_system": true}}
+]`
+
+// response — ответ хэндлера
+type response struct {
+	status int
+	header http.Header
+	body   map[string]any
+}
+
+// serve отправляет запрос в хэндлер и разбирает JSON ответ
+func serve(t *testing.T, h *StatusHandler, method, body string, header map[string]string) response {
+	t.Helper()
+	req := httptest.NewRequest(method, "/status/status/", strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	result := response{status: rec.Code, header: rec.Header()}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result.body); err != nil {
+		t.Fatalf("response is not JSON: %q", rec.Body.String())
+	}
+	return result
+}
+
+func newTestHandler() (*StatusHandler, *publisher.Memory) {
+	memory := publisher.NewMemory(publisher.MemoryOptions{})
+	return NewStatusHandler(memory, rabbitmq.DefaultRouter(0), nil, nil), memory
+}
+
+func TestStatusHandlerSuccess(t *testing.T) {
+	h, memory := newTestHandler()
+	resp := serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusOK || resp.body["status"] != "SUCCESS" || resp.body["processed"] != 2.0 {
+		t.Fatalf("got %d %v, want 200 SUCCESS with 2 processed", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 1 || memory.Count(rabbitmq.QueueSystemGolang) != 1 {
+		t.Errorf("published %d to %s and %d to %s, want 1 and 1",
+			memory.Count(rabbitmq.QueueGolang), rabbitmq.QueueGolang,
+			memory.Count(rabbitmq.QueueSystemGolang), rabbitmq.QueueSystemGolang)
+	}
+}
+
+func TestStatusHandlerNack(t *testing.T) {
+	h, memory := newTestHandler()
+	memory.NackNext(1)
+	resp := serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusBadRequest || resp.body["status"] != "PARTIAL_SUCCESS" || resp.body["processed"] != 1.0 {
+		t.Fatalf("got %d %v, want 400 PARTIAL_SUCCESS with 1 processed", resp.status, resp.body)
+	}
+	if errorsList, _ := resp.body["errors"].([]any); len(errorsList) != 1 {
+		t.Errorf("errors = %v, want one nacked event", resp.body["errors"])
+	}
+}
+
+func TestStatusHandlerUnavailable(t *testing.T) {
+	h, memory := newTestHandler()
+	memory.FailNext(2, rabbitmq.ErrUnavailable)
+	resp := serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusServiceUnavailable {
+		t.Fatalf("got %d %v, want 503", resp.status, resp.body)
+	}
+}
+
+func TestStatusHandlerBadRequest(t *testing.T) {
+	h, memory := newTestHandler()
+	tests := []struct {
+		name, method, body string
+		status             int
+	}{
+		{"method", http.MethodGet, events, http.StatusMethodNotAllowed},
+		{"empty body", http.MethodPost, "", http.StatusBadRequest},
+		{"not an array", http.MethodPost, `{"txId": "tx-1"}`, http.StatusBadRequest},
+		{"empty array", http.MethodPost, `[]`, http.StatusBadRequest},
+		{"invalid event", http.MethodPost, `[{"txId": "tx-1"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := serve(t, h, tt.method, tt.body, nil); resp.status != tt.status {
+				t.Errorf("got %d %v, want %d", resp.status, resp.body, tt.status)
+			}
+		})
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 0 {
+		t.Errorf("invalid requests published %d events", memory.Count(rabbitmq.QueueGolang))
+	}
+}
+
+// newDedupHandler — хэндлер с кэшем дедупликации
+func newDedupHandler() (*StatusHandler, *publisher.Memory, *dedup.Cache) {
+	memory := publisher.NewMemory(publisher.MemoryOptions{})
+	cache := dedup.New(time.Minute, 100, 1)
+	return NewStatusHandler(memory, rabbitmq.DefaultRouter(0), cache, nil), memory, cache
+}
+
+func TestStatusHandlerDedup(t *testing.T) {
+	h, memory, _ := newDedupHandler()
+	serve(t, h, http.MethodPost, events, nil)
+	resp := serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusOK || resp.body["duplicates"] != 2.0 {
+		t.Fatalf("got %d %v, want 200 with 2 duplicates", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 1 {
+		t.Errorf("published %d events to %s, want 1", memory.Count(rabbitmq.QueueGolang), rabbitmq.QueueGolang)
+	}
+}
+
+// TestStatusHandlerDedupNack проверяет, что повтор публикует событие, которое брокер не принял
+func TestStatusHandlerDedupNack(t *testing.T) {
+	h, memory, _ := newDedupHandler()
+	memory.NackNext(1)
+	serve(t, h, http.MethodPost, events, nil)
+	resp := serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusOK || resp.body["duplicates"] != 1.0 {
+		t.Fatalf("got %d %v, want 200 with 1 duplicate", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 1 {
+		t.Errorf("published %d events to %s, want 1", memory.Count(rabbitmq.QueueGolang), rabbitmq.QueueGolang)
+	}
+}
+
+// TestStatusHandlerDedupInFlight проверяет, что событие, которое еще публикует параллельный запрос,
+// не подтверждается как повтор
+func TestStatusHandlerDedupInFlight(t *testing.T) {
+	h, memory, cache := newDedupHandler()
+	event := models.StatusEvent{TxID: "tx-1", State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z"}
+	key := event.DedupKey()
+	reservation, _, err := cache.Begin(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusBadRequest || resp.body["processed"] != 1.0 || resp.body["duplicates"] != nil {
+		t.Fatalf("got %d %v, want 400 with 1 processed and no duplicates", resp.status, resp.body)
+	}
+	// Параллельная публикация не удалась — повтор публикует событие
+	cache.Finish(reservation, false)
+	resp = serve(t, h, http.MethodPost, events, nil)
+	if resp.status != http.StatusOK || resp.body["duplicates"] != 1.0 {
+		t.Fatalf("got %d %v, want 200 with 1 duplicate", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 1 {
+		t.Errorf("published %d events to %s, want 1", memory.Count(rabbitmq.QueueGolang), rabbitmq.QueueGolang)
+	}
+}
+
+// TestStatusHandlerDedupBatch проверяет, что повтор события внутри одного запроса
+// считается дубликатом, а не событием другого запроса в обработке
+func TestStatusHandlerDedupBatch(t *testing.T) {
+	h, memory, _ := newDedupHandler()
+	body := `[
+		{"txId": "tx-1", "state": "SUCCESS", "updatedAt": "2024-05-01T12:00:00Z"},
+		{"txId": "tx-1", "state": "SUCCESS", "updatedAt": "2024-05-01T12:00:00Z"}
+	]`
+	resp := serve(t, h, http.MethodPost, body, nil)
+	if resp.status != http.StatusOK || resp.body["processed"] != 2.0 || resp.body["duplicates"] != 1.0 {
+		t.Fatalf("got %d %v, want 200 with 2 processed and 1 duplicate", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 1 {
+		t.Errorf("published %d events to %s, want 1", memory.Count(rabbitmq.QueueGolang), rabbitmq.QueueGolang)
+	}
+}
+
+// TestStatusHandlerDedupAsync проверяет, что в асинхронном режиме ключ события,
+// которое воркер не смог опубликовать, забывается
+func TestStatusHandlerDedupAsync(t *testing.T) {
+	memory := publisher.NewMemory(publisher.MemoryOptions{})
+	memory.NackNext(1)
+	async := publisher.NewAsync(memory, publisher.AsyncOptions{QueueSize: 10})
+	cache := dedup.New(time.Minute, 100, 1)
+	h := NewStatusHandler(async, rabbitmq.DefaultRouter(0), cache, nil)
+	if resp := serve(t, h, http.MethodPost, events, nil); resp.status != http.StatusAccepted {
+		t.Fatalf("got %d %v, want 202", resp.status, resp.body)
+	}
+	// Close дожидается, пока воркер опубликует очередь
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nacked := models.StatusEvent{TxID: "tx-1", State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z"}
+	if _, duplicate, err := cache.Begin(nacked.DedupKey()); duplicate || err != nil {
+		t.Errorf("nacked event: Begin() = %v, %v; want it forgotten", duplicate, err)
+	}
+	published := models.StatusEvent{TxID: "tx-2", State: "FAILED", UpdatedAt: "2024-05-01T12:00:01Z"}
+	if _, duplicate, _ := cache.Begin(published.DedupKey()); !duplicate {
+		t.Error("published event is not remembered")
+	}
+}
+
+// panicPublisher паникует при публикации, как хэндлер с ошибкой в коде
+type panicPublisher struct {
+	*publisher.Memory
+}
+
+func (panicPublisher) PublishBatch(context.Context, []rabbitmq.Message) []error {
+	panic("publish failed")
+}
+
+// TestStatusHandlerIdempotencyInvalidRequest проверяет, что отклоненный запрос не занимает ключ
+func TestStatusHandlerIdempotencyInvalidRequest(t *testing.T) {
+	memory := publisher.NewMemory(publisher.MemoryOptions{})
+	h := NewStatusHandler(memory, rabbitmq.DefaultRouter(0), nil, idempotency.NewStore(time.Minute, 100))
+	header := map[string]string{idempotency.Header: "key-1"}
+	if resp := serve(t, h, http.MethodGet, events, header); resp.status != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d %v, want 405", resp.status, resp.body)
+	}
+	resp := serve(t, h, http.MethodPost, events, header)
+	if resp.status != http.StatusOK || resp.header.Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("got %d %v %v, want 200 not replayed", resp.status, resp.header, resp.body)
+	}
+	resp = serve(t, h, http.MethodPost, events, header)
+	if resp.status != http.StatusOK || resp.header.Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatalf("got %d %v %v, want replayed 200", resp.status, resp.header, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 1 {
+		t.Errorf("published %d events to %s, want 1", memory.Count(rabbitmq.QueueGolang), rabbitmq.QueueGolang)
+	}
+}
+
+// TestStatusHandlerIdempotencyPanic проверяет, что паника при обработке освобождает ключ
+func TestStatusHandlerIdempotencyPanic(t *testing.T) {
+	store := idempotency.NewStore(time.Minute, 100)
+	h := NewStatusHandler(panicPublisher{publisher.NewMemory(publisher.MemoryOptions{})}, rabbitmq.DefaultRouter(0), nil, store)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("handler did not panic")
+			}
+		}()
+		serve(t, h, http.MethodPost, events, map[string]string{idempotency.Header: "key-1"})
+	}()
+	if replay, err := store.Begin("key-1"); replay != nil || err != nil {
+		t.Errorf("Begin() after panic = %v, %v; want the key released", replay, err)
+	}
+}
+
+// newIdempotentHandler — хэндлер с хранилищем ответов для Idempotency-Key
+func newIdempotentHandler() (*StatusHandler, *publisher.Memory, *idempotency.Store) {
+	memory := publisher.NewMemory(publisher.MemoryOptions{})
+	store := idempotency.NewStore(time.Minute, 100)
+	return NewStatusHandler(memory, rabbitmq.DefaultRouter(0), nil, store), memory, store
+}
+
+func TestStatusHandlerIdempotencyReplay(t *testing.T) {
+	h, memory, _ := newIdempotentHandler()
+	header := map[string]string{idempotency.Header: "key-1"}
+	memory.NackNext(1)
+	first := serve(t, h, http.MethodPost, events, header)
+	if first.status != http.StatusBadRequest || first.header.Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("got %d %v, want 400 PARTIAL_SUCCESS not replayed", first.status, first.body)
+	}
+	// Повтор получает тот же ответ и ничего не публикует
+	replay := serve(t, h, http.MethodPost, events, header)
+	if replay.status != first.status || replay.header.Get(idempotency.ReplayedHeader) != "true" ||
+		replay.body["status"] != "PARTIAL_SUCCESS" || replay.body["processed"] != first.body["processed"] {
+		t.Fatalf("got %d %v %v, want replayed %d %v", replay.status, replay.header, replay.body, first.status, first.body)
+	}
+	if memory.Count(rabbitmq.QueueSystemGolang) != 1 {
+		t.Errorf("published %d events to %s, want 1", memory.Count(rabbitmq.QueueSystemGolang), rabbitmq.QueueSystemGolang)
+	}
+}
+
+func TestStatusHandlerIdempotencyInFlight(t *testing.T) {
+	h, memory, store := newIdempotentHandler()
+	if _, err := store.Begin("key-1"); err != nil {
+		t.Fatal(err)
+	}
+	resp := serve(t, h, http.MethodPost, events, map[string]string{idempotency.Header: "key-1"})
+	if resp.status != http.StatusConflict {
+		t.Fatalf("got %d %v, want 409", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 0 {
+		t.Errorf("request in flight published %d events", memory.Count(rabbitmq.QueueGolang))
+	}
+}
+
+// TestStatusHandlerIdempotencyUnavailable проверяет, что 503 не сохраняется и повтор публикует события
+func TestStatusHandlerIdempotencyUnavailable(t *testing.T) {
+	h, memory, _ := newIdempotentHandler()
+	header := map[string]string{idempotency.Header: "key-1"}
+	memory.FailNext(2, rabbitmq.ErrUnavailable)
+	if resp := serve(t, h, http.MethodPost, events, header); resp.status != http.StatusServiceUnavailable {
+		t.Fatalf("got %d %v, want 503", resp.status, resp.body)
+	}
+	resp := serve(t, h, http.MethodPost, events, header)
+	if resp.status != http.StatusOK || resp.header.Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("got %d %v %v, want 200 not replayed", resp.status, resp.header, resp.body)
+	}
+}
+
+func TestStatusHandlerIdempotencyKeyTooLong(t *testing.T) {
+	h, memory, _ := newIdempotentHandler()
+	key := strings.Repeat("k", idempotency.MaxKeyLength+1)
+	resp := serve(t, h, http.MethodPost, events, map[string]string{idempotency.Header: key})
+	if resp.status != http.StatusBadRequest {
+		t.Fatalf("got %d %v, want 400", resp.status, resp.body)
+	}
+	if memory.Count(rabbitmq.QueueGolang) != 0 {
+		t.Errorf("request with invalid key published %d events", memory.Count(rabbitmq.QueueGolang))
+	}
+}
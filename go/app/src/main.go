@@ -12,7 +12,11 @@ import (
 	"time"
 
 	"github.com/ex10se/http-perf-test/go/config"
+	"github.com/ex10se/http-perf-test/go/dedup"
 	"github.com/ex10se/http-perf-test/go/handlers"
+	"github.com/ex10se/http-perf-test/go/idempotency"
+	"github.com/ex10se/http-perf-test/go/metrics"
+	"github.com/ex10se/http-perf-test/go/publisher"
 	"github.com/ex10se/http-perf-test/go/rabbitmq"
 )
 
@@ -20,24 +24,80 @@ func main() {
 	// Загружаем конфигурацию
 	cfg := config.Load()
 	log.Printf("Starting server on %s", cfg.SocketPath)
-	log.Printf("RabbitMQ URL: %s", cfg.RabbitMQURL)
-	// Создаем RabbitMQ клиент
-	rmqClient := rabbitmq.New(cfg.RabbitMQURL)
+	// Загружаем топологию брокера из файла, если он задан
+	var topology *rabbitmq.Topology
+	if cfg.RabbitMQTopologyFile != "" {
+		var err error
+		topology, err = rabbitmq.LoadTopology(cfg.RabbitMQTopologyFile)
+		if err != nil {
+			log.Fatalf("Failed to load RabbitMQ topology: %v", err)
+		}
+		log.Printf("RabbitMQ topology loaded from %s", cfg.RabbitMQTopologyFile)
+	}
+	// Правила маршрутизации событий из файла топологии или по умолчанию по is_system
+	eventRouter := rabbitmq.DefaultRouter(cfg.RabbitMQShards)
+	if topology != nil && topology.Routing != nil {
+		eventRouter = topology.Routing
+	}
+	// Сообщения публикуются без mandatory: ключ без подходящей привязки брокер молча отбросит
+	if topology != nil {
+		if err := topology.CheckRouting(eventRouter); err != nil {
+			log.Fatalf("Invalid RabbitMQ topology %s: %v", cfg.RabbitMQTopologyFile, err)
+		}
+	}
+	// Создаем бэкенд публикации событий
+	log.Printf("Publisher backend: %s", cfg.PublisherBackend)
+	if cfg.AsyncPublish {
+		log.Printf("Async publishing: queue of %d events, %d workers", cfg.AsyncQueueSize, cfg.AsyncWorkers)
+	}
+	pub, err := publisher.New(cfg, topology)
+	if err != nil {
+		// Exchange или очередь уже существуют с другими аргументами (например, другим x-queue-type)
+		var mismatch *rabbitmq.TopologyMismatchError
+		if errors.As(err, &mismatch) {
+			log.Printf("RabbitMQ topology does not match the configuration: %v", mismatch)
+			log.Printf("Check RABBITMQ_TOPOLOGY_FILE, RABBITMQ_QUEUE_TYPE, RABBITMQ_QUEUE_TYPES and the other RABBITMQ_* queue settings")
+			os.Exit(1)
+		}
+		log.Fatalf("Failed to create publisher: %v", err)
+	}
+	// В асинхронном режиме Close сначала дожидается публикации очереди
 	defer func() {
-		if err := rmqClient.Close(); err != nil {
-			log.Printf("Error closing RabbitMQ client: %v", err)
+		if err := pub.Close(); err != nil {
+			log.Printf("Error closing publisher: %v", err)
 		}
 	}()
-	// Декларируем очереди
-	log.Println("Declaring RabbitMQ queues...")
-	if err := rmqClient.DeclareQueues(); err != nil {
-		log.Fatalf("Failed to declare queues: %v", err)
+	// Кэш дедупликации повторно присланных событий
+	var dedupCache *dedup.Cache
+	if cfg.DedupTTL > 0 {
+		dedupCache = dedup.New(cfg.DedupTTL, cfg.DedupCapacity, cfg.DedupShards)
+		log.Printf("Deduplicating events for %v, up to %d events", cfg.DedupTTL, cfg.DedupCapacity)
+	}
+	// Хранилище ответов на запросы с Idempotency-Key
+	var idempotencyStore *idempotency.Store
+	if cfg.IdempotencyTTL > 0 {
+		idempotencyStore = idempotency.NewStore(cfg.IdempotencyTTL, cfg.IdempotencyCapacity)
+		log.Printf("Replaying responses by Idempotency-Key for %v", cfg.IdempotencyTTL)
+	}
+	// Метрики (глубина спула и т.п.) на отдельном внутреннем адресе
+	if cfg.MetricsAddr != "" {
+		metricsServer, err := metrics.Serve(cfg.MetricsAddr)
+		if err != nil {
+			log.Fatalf("Failed to start metrics server: %v", err)
+		}
+		defer func() {
+			if err := metricsServer.Close(); err != nil {
+				log.Printf("Error closing metrics server: %v", err)
+			}
+		}()
+		log.Printf("Metrics available on http://%s/debug/vars", metricsServer.Addr)
 	}
 	// Создаем HTTP хэндлер
-	statusHandler := handlers.NewStatusHandler(rmqClient)
+	statusHandler := handlers.NewStatusHandler(pub, eventRouter, dedupCache, idempotencyStore)
 	// Настраиваем роутинг
 	mux := http.NewServeMux()
 	mux.Handle("/status/status/", statusHandler)
+	mux.HandleFunc("/health/", statusHandler.Health)
 	// Создаем Unix socket
 	if err := os.RemoveAll(cfg.SocketPath); err != nil {
 		log.Fatalf("Failed to remove old socket: %v", err)
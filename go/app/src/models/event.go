@@ -10,6 +10,12 @@ type ErrorData struct {
 	Message *string `json:"message,omitempty"`
 }
 
+// MaxPriority — наибольший приоритет события, который допускает AMQP.
+// Validate принимает весь диапазон AMQP: очереди с x-max-priority (RABBITMQ_MAX_PRIORITY)
+// здесь неизвестны, поэтому приоритет выше него клиент RabbitMQ понижает до x-max-priority
+// при публикации — так же брокер обходится с такими сообщениями сам
+const MaxPriority = 255
+
 // TrackData содержит метаданные трекинга события
 type TrackData struct {
 	Priority *int `json:"priority,omitempty"`
@@ -28,7 +34,7 @@ type StatusEvent struct {
 	Channel   *string    `json:"channel,omitempty"`
 }
 
-// Validate проверяет обязательные поля события
+// Validate проверяет обязательные поля события и что trackData.priority в диапазоне 0..MaxPriority
 func (e *StatusEvent) Validate() error {
 	if e.State == "" {
 		return fmt.Errorf("field 'state' is required")
@@ -39,6 +45,11 @@ func (e *StatusEvent) Validate() error {
 	if e.TxID == "" {
 		return fmt.Errorf("field 'txId' is required")
 	}
+	if e.TrackData != nil && e.TrackData.Priority != nil {
+		if priority := *e.TrackData.Priority; priority < 0 || priority > MaxPriority {
+			return fmt.Errorf("field 'trackData.priority' must be between 0 and %d, got %d", MaxPriority, priority)
+		}
+	}
 	return nil
 }
 
@@ -49,3 +60,9 @@ func (e *StatusEvent) IsSystemEvent() bool {
 	}
 	return false
 }
+
+// DedupKey возвращает ключ события для дедупликации повторных отправок:
+// одно и то же изменение статуса транзакции имеет одинаковые txId, state и updatedAt
+func (e *StatusEvent) DedupKey() string {
+	return e.TxID + "\x00" + e.State + "\x00" + e.UpdatedAt
+}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestStatusEventValidate(t *testing.T) {
+	priority := func(p int) *TrackData { return &TrackData{Priority: &p} }
+	tests := []struct {
+		name    string
+		event   StatusEvent
+		wantErr bool
+	}{
+		{name: "valid", event: StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1"}},
+		{name: "missing state", event: StatusEvent{UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1"}, wantErr: true},
+		{name: "missing updatedAt", event: StatusEvent{State: "SUCCESS", TxID: "tx-1"}, wantErr: true},
+		{name: "missing txId", event: StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z"}, wantErr: true},
+		{name: "without priority", event: StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1", TrackData: &TrackData{}}},
+		// Приоритет выше x-max-priority очередей допустим и понижается при публикации
+		{name: "max priority", event: StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1", TrackData: priority(MaxPriority)}},
+		{name: "priority above AMQP range", event: StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1", TrackData: priority(MaxPriority + 1)}, wantErr: true},
+		{name: "negative priority", event: StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1", TrackData: priority(-1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.event.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package publisher
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go/rabbitmq"
+)
+
+// MemoryOptions задает сбои, которые Memory вносит в каждую публикацию
+type MemoryOptions struct {
+	// FailureRate — доля сообщений (0..1), которые завершаются ошибкой rabbitmq.ErrUnavailable
+	FailureRate float64
+	// NackRate — доля сообщений (0..1), которые завершаются ошибкой rabbitmq.ErrNacked
+	NackRate float64
+	// Latency — задержка каждого вызова PublishBatch
+	Latency time.Duration
+	// Capacity — сколько последних сообщений хранится на очередь, 0 — без ограничения.
+	// Ограничение нужно чтобы нагрузочный прогон не съел всю память
+	Capacity int
+	// Topology — топология, по привязкам которой сообщения раскладываются по очередям,
+	// nil — rabbitmq.DefaultTopology без шардирования
+	Topology *rabbitmq.Topology
+}
+
+// Memory — публикатор в памяти вместо RabbitMQ для локального запуска и тестов хэндлеров.
+// Сохраняет сообщения в очереди, в которые их доставил бы брокер по привязкам топологии
+// (rabbitmq.Topology.Destinations), и умеет по запросу возвращать ошибки, nack и задерживать ответ.
+// Сообщение, которое не доходит ни до одной очереди, отбрасывается, как у брокера без mandatory.
+// Если маршрутизацию exchange определить нельзя (headers и x-*), очередью считается ключ маршрутизации
+type Memory struct {
+	mu     sync.Mutex
+	opts   MemoryOptions
+	queues map[string][]rabbitmq.Message
+	// failNext и nackNext — сколько следующих сообщений завершатся ошибкой или nack
+	failNext int
+	failErr  error
+	nackNext int
+	health   error
+}
+
+var _ Publisher = (*Memory)(nil)
+
+// NewMemory создает пустой публикатор в памяти
+func NewMemory(opts MemoryOptions) *Memory {
+	if opts.Topology == nil {
+		opts.Topology = rabbitmq.DefaultTopology(rabbitmq.QueueOptions{})
+	}
+	return &Memory{
+		opts:   opts,
+		queues: map[string][]rabbitmq.Message{},
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, routingKey string, body []byte) error {
+	return m.PublishBatch(ctx, []rabbitmq.Message{{RoutingKey: routingKey, Body: body}})[0]
+}
+
+func (m *Memory) PublishBatch(ctx context.Context, messages []rabbitmq.Message) []error {
+	results := make([]error, len(messages))
+	m.mu.Lock()
+	latency := m.opts.Latency
+	m.mu.Unlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			for i := range results {
+				results[i] = ctx.Err()
+			}
+			return results
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, message := range messages {
+		switch {
+		case m.failNext > 0:
+			m.failNext--
+			results[i] = m.failErr
+		case m.nackNext > 0:
+			m.nackNext--
+			results[i] = rabbitmq.ErrNacked
+		case m.opts.FailureRate > 0 && rand.Float64() < m.opts.FailureRate:
+			results[i] = rabbitmq.ErrUnavailable
+		case m.opts.NackRate > 0 && rand.Float64() < m.opts.NackRate:
+			results[i] = rabbitmq.ErrNacked
+		default:
+			for _, queueName := range m.destinations(message) {
+				queue := m.queues[queueName]
+				if m.opts.Capacity > 0 && len(queue) >= m.opts.Capacity {
+					queue = queue[len(queue)-m.opts.Capacity+1:]
+				}
+				m.queues[queueName] = append(queue, message)
+			}
+		}
+	}
+	return results
+}
+
+// destinations возвращает очереди, в которые брокер доставил бы сообщение
+func (m *Memory) destinations(message rabbitmq.Message) []string {
+	exchange := message.Exchange
+	if exchange == "" {
+		exchange = m.opts.Topology.Exchange
+	}
+	queues, known := m.opts.Topology.Destinations(exchange, message.RoutingKey)
+	if !known {
+		return []string{message.RoutingKey}
+	}
+	return queues
+}
+
+func (m *Memory) Health(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.health
+}
+
+func (m *Memory) Close() error { return nil }
+
+// FailNext заставляет следующие n сообщений завершиться ошибкой err
+func (m *Memory) FailNext(n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failNext, m.failErr = n, err
+}
+
+// NackNext заставляет следующие n сообщений завершиться rabbitmq.ErrNacked
+func (m *Memory) NackNext(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nackNext = n
+}
+
+// SetLatency меняет задержку публикации
+func (m *Memory) SetLatency(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opts.Latency = latency
+}
+
+// SetHealth задает ошибку, которую возвращает Health, nil — бэкенд здоров
+func (m *Memory) SetHealth(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.health = err
+}
+
+// Messages возвращает копию сообщений, доставленных в очередь queue
+func (m *Memory) Messages(queue string) []rabbitmq.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]rabbitmq.Message(nil), m.queues[queue]...)
+}
+
+// Count возвращает количество сохраненных сообщений в очереди queue
+func (m *Memory) Count(queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.queues[queue])
+}
+
+// Reset удаляет сохраненные сообщения и отменяет внесенные сбои
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues = map[string][]rabbitmq.Message{}
+	m.failNext, m.failErr, m.nackNext, m.health = 0, nil, 0, nil
+}
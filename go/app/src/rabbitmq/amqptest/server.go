@@ -0,0 +1,764 @@
+package amqptest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+)
+
+// Server — AMQP 0-9-1 брокер в памяти для тестов клиента и консьюмеров.
+// Поддерживает ровно то, что использует amqp091: handshake с PLAIN и EXTERNAL,
+// декларации, publisher confirms, basic.publish, basic.get, ack, nack и reject.
+// По запросу теста отклоняет публикации (NackNext, NackIf),
+// обрывает соединения (CloseConnections), не пускает новые (Reject)
+// и присылает connection.blocked и connection.unblocked (Block, Unblock).
+// Маршрутизирует через default exchange, direct и fanout exchanges;
+// остальные типы exchanges маршрутизируются как direct
+type Server struct {
+	listener net.Listener
+	scheme   string
+	mu       sync.Mutex
+	queues   map[string][]Message
+	// exchanges — тип exchange по имени
+	exchanges map[string]string
+	// bindings — очереди по exchange и ключу маршрутизации
+	bindings map[string]map[string][]string
+	// mechanisms — SASL механизмы, выбранные клиентами, в порядке подключения
+	mechanisms []string
+	// clientNames — CommonName клиентских сертификатов TLS соединений
+	clientNames []string
+	// nackNext — сколько следующих публикаций в режиме confirms брокер отклонит
+	nackNext int
+	// nackIf отбирает публикации, которые брокер отклонит, nil — никакие
+	nackIf func(Message) bool
+	// reject — брокер закрывает новые соединения сразу после accept
+	reject bool
+	conns  map[net.Conn]*serverConn
+	wg     sync.WaitGroup
+}
+
+// Message — сообщение в очереди
+type Message struct {
+	Exchange    string
+	RoutingKey  string
+	Redelivered bool
+	Body        []byte
+	// header — content header frame в том виде, в каком его прислал издатель
+	header []byte
+}
+
+// NewServer запускает брокер на случайном порту 127.0.0.1
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("amqptest: failed to listen: " + err.Error())
+	}
+	return start(listener, "amqp")
+}
+
+// NewTLSServer запускает брокер, который принимает только TLS соединения с настройками config
+func NewTLSServer(config *tls.Config) *Server {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		panic("amqptest: failed to listen: " + err.Error())
+	}
+	return start(listener, "amqps")
+}
+
+func start(listener net.Listener, scheme string) *Server {
+	s := &Server{
+		listener:  listener,
+		scheme:    scheme,
+		queues:    map[string][]Message{},
+		exchanges: map[string]string{},
+		bindings:  map[string]map[string][]string{},
+		conns:     map[net.Conn]*serverConn{},
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// URL возвращает адрес брокера с логином guest:guest
+func (s *Server) URL() string {
+	return s.scheme + "://guest:guest@" + s.listener.Addr().String() + "/"
+}
+
+// Close закрывает listener и все соединения
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.CloseConnections()
+	s.wg.Wait()
+}
+
+// Messages возвращает сообщения, ожидающие в очереди
+func (s *Server) Messages(queue string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.queues[queue]...)
+}
+
+// Mechanisms возвращает SASL механизмы, которыми аутентифицировались клиенты
+func (s *Server) Mechanisms() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.mechanisms...)
+}
+
+// ClientNames возвращает CommonName клиентских сертификатов, предъявленных при TLS handshake
+func (s *Server) ClientNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.clientNames...)
+}
+
+// NackNext заставляет брокер отклонить (basic.nack) следующие n публикаций в режиме confirms.
+// Отклоненные сообщения не попадают в очереди
+func (s *Server) NackNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nackNext = n
+}
+
+// NackIf заставляет брокер отклонять публикации в режиме confirms, для которых match возвращает true
+func (s *Server) NackIf(match func(Message) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nackIf = match
+}
+
+// CloseConnections обрывает открытые соединения, как при падении узла.
+// Брокер продолжает принимать подключения, очереди сохраняются
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// Reject заставляет брокер закрывать новые соединения сразу после accept.
+// Уже открытые соединения продолжают работать
+func (s *Server) Reject(reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = reject
+}
+
+// Block присылает connection.blocked с причиной reason во все открытые соединения,
+// как брокер при memory или disk alarm. Публикации при этом принимаются как обычно
+func (s *Server) Block(reason string) {
+	args := &encoder{}
+	args.shortstr(reason)
+	s.notify(connectionBlocked, args)
+}
+
+// Unblock присылает connection.unblocked во все открытые соединения
+func (s *Server) Unblock() {
+	s.notify(connectionUnblocked, &encoder{})
+}
+
+// notify отправляет метод соединения во все открытые соединения
+func (s *Server) notify(method methodID, args *encoder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		_ = c.method(0, method, args)
+	}
+}
+
+// Connections возвращает число открытых соединений
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.reject {
+			s.mu.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		c := &serverConn{server: s, conn: conn, writer: bufio.NewWriter(conn), channels: map[uint16]*channel{}}
+		s.conns[conn] = c
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			_ = conn.Close()
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// route кладет сообщение в очереди, привязанные к exchange. Вызывается под s.mu
+func (s *Server) route(message Message) {
+	var queues []string
+	switch {
+	case message.Exchange == "":
+		if _, ok := s.queues[message.RoutingKey]; ok {
+			queues = []string{message.RoutingKey}
+		}
+	case s.exchanges[message.Exchange] == "fanout":
+		for _, bound := range s.bindings[message.Exchange] {
+			queues = append(queues, bound...)
+		}
+	default:
+		queues = s.bindings[message.Exchange][message.RoutingKey]
+	}
+	for _, queue := range queues {
+		s.queues[queue] = append(s.queues[queue], message)
+	}
+}
+
+// Коды фреймов и методов AMQP 0-9-1
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+	frameMax       = 131072
+)
+
+type methodID struct {
+	class, method uint16
+}
+
+var (
+	connectionStart     = methodID{10, 10}
+	connectionStartOk   = methodID{10, 11}
+	connectionTune      = methodID{10, 30}
+	connectionTuneOk    = methodID{10, 31}
+	connectionOpen      = methodID{10, 40}
+	connectionOpenOk    = methodID{10, 41}
+	connectionClose     = methodID{10, 50}
+	connectionCloseOk   = methodID{10, 51}
+	connectionBlocked   = methodID{10, 60}
+	connectionUnblocked = methodID{10, 61}
+	channelOpen         = methodID{20, 10}
+	channelOpenOk       = methodID{20, 11}
+	channelClose        = methodID{20, 40}
+	channelCloseOk      = methodID{20, 41}
+	exchangeDeclare     = methodID{40, 10}
+	exchangeDeclareOk   = methodID{40, 11}
+	queueDeclare        = methodID{50, 10}
+	queueDeclareOk      = methodID{50, 11}
+	queueBind           = methodID{50, 20}
+	queueBindOk         = methodID{50, 21}
+	basicQos            = methodID{60, 10}
+	basicQosOk          = methodID{60, 11}
+	basicPublish        = methodID{60, 40}
+	basicGet            = methodID{60, 70}
+	basicGetOk          = methodID{60, 71}
+	basicGetEmpty       = methodID{60, 72}
+	basicAck            = methodID{60, 80}
+	basicReject         = methodID{60, 90}
+	basicNack           = methodID{60, 120}
+	confirmSelect       = methodID{85, 10}
+	confirmSelectOk     = methodID{85, 11}
+)
+
+var errMalformedFrame = errors.New("amqptest: malformed frame")
+
+// serverCapabilities — возможности брокера, которые проверяет amqp091
+var serverCapabilities = []string{"publisher_confirms", "basic.nack", "connection.blocked", "consumer_cancel_notify"}
+
+// unacked — выданное через basic.get сообщение, которое ждет ack
+type unacked struct {
+	queue   string
+	message Message
+}
+
+// channel — состояние канала соединения
+type channel struct {
+	confirm bool
+	// published — номер последнего опубликованного сообщения для publisher confirms
+	published uint64
+	// deliveryTag — номер последней выдачи basic.get
+	deliveryTag uint64
+	unacked     map[uint64]unacked
+	// publishing — публикация, для которой ждем header и body
+	publishing *Message
+	bodySize   uint64
+}
+
+type serverConn struct {
+	server *Server
+	conn   net.Conn
+	// writeMu сериализует запись фреймов горутиной serve и уведомлениями Block и Unblock
+	writeMu  sync.Mutex
+	writer   *bufio.Writer
+	channels map[uint16]*channel
+}
+
+func (c *serverConn) serve() {
+	// Возвращаем неподтвержденные сообщения в очереди, как это делает брокер при обрыве соединения
+	defer func() {
+		for _, ch := range c.channels {
+			c.requeue(ch, func(uint64) bool { return true })
+		}
+	}()
+	if tlsConn, ok := c.conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			c.server.mu.Lock()
+			c.server.clientNames = append(c.server.clientNames, certs[0].Subject.CommonName)
+			c.server.mu.Unlock()
+		}
+	}
+	reader := bufio.NewReader(c.conn)
+	protocol := make([]byte, 8)
+	if _, err := io.ReadFull(reader, protocol); err != nil || !bytes.HasPrefix(protocol, []byte("AMQP")) {
+		return
+	}
+	start := &encoder{}
+	start.u8(0)
+	start.u8(9)
+	start.capabilities(serverCapabilities)
+	start.longstr("PLAIN AMQPLAIN EXTERNAL")
+	start.longstr("en_US")
+	if c.method(0, connectionStart, start) != nil {
+		return
+	}
+	for {
+		kind, id, payload, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		if err := c.handle(kind, id, payload); err != nil {
+			return
+		}
+	}
+}
+
+// handle обрабатывает один фрейм. Ошибка закрывает соединение
+func (c *serverConn) handle(kind byte, id uint16, payload []byte) error {
+	switch kind {
+	case frameHeartbeat:
+		return nil
+	case frameHeader:
+		ch := c.channels[id]
+		if ch == nil || ch.publishing == nil || len(payload) < 14 {
+			return errMalformedFrame
+		}
+		ch.publishing.header = append([]byte(nil), payload...)
+		ch.bodySize = binary.BigEndian.Uint64(payload[4:12])
+		if ch.bodySize == 0 {
+			return c.published(ch, id)
+		}
+		return nil
+	case frameBody:
+		ch := c.channels[id]
+		if ch == nil || ch.publishing == nil {
+			return errMalformedFrame
+		}
+		ch.publishing.Body = append(ch.publishing.Body, payload...)
+		if uint64(len(ch.publishing.Body)) >= ch.bodySize {
+			return c.published(ch, id)
+		}
+		return nil
+	case frameMethod:
+	default:
+		return errMalformedFrame
+	}
+	d := &decoder{data: payload}
+	method := methodID{d.u16(), d.u16()}
+	if d.err != nil {
+		return d.err
+	}
+	if method == connectionStartOk || method == connectionTuneOk || method == connectionOpen ||
+		method == connectionClose || method == connectionCloseOk || method == channelOpen {
+		return c.handleConnection(id, method, d)
+	}
+	ch := c.channels[id]
+	if ch == nil {
+		return errMalformedFrame
+	}
+	return c.handleChannel(ch, id, method, d)
+}
+
+// handleConnection обрабатывает методы handshake, открытия и закрытия
+func (c *serverConn) handleConnection(id uint16, method methodID, d *decoder) error {
+	switch method {
+	case connectionStartOk:
+		d.table()
+		mechanism := d.shortstr()
+		if d.err != nil {
+			return d.err
+		}
+		c.server.mu.Lock()
+		c.server.mechanisms = append(c.server.mechanisms, mechanism)
+		c.server.mu.Unlock()
+		tune := &encoder{}
+		tune.u16(2047)
+		tune.u32(frameMax)
+		tune.u16(0)
+		return c.method(0, connectionTune, tune)
+	case connectionTuneOk:
+		return nil
+	case connectionOpen:
+		openOk := &encoder{}
+		openOk.shortstr("")
+		return c.method(0, connectionOpenOk, openOk)
+	case connectionClose:
+		_ = c.method(0, connectionCloseOk, &encoder{})
+		return io.EOF
+	case connectionCloseOk:
+		return io.EOF
+	default: // channelOpen
+		c.channels[id] = &channel{unacked: map[uint64]unacked{}}
+		openOk := &encoder{}
+		openOk.longstr("")
+		return c.method(id, channelOpenOk, openOk)
+	}
+}
+
+// handleChannel обрабатывает методы открытого канала
+func (c *serverConn) handleChannel(ch *channel, id uint16, method methodID, d *decoder) error {
+	s := c.server
+	switch method {
+	case channelClose:
+		c.requeue(ch, func(uint64) bool { return true })
+		delete(c.channels, id)
+		return c.method(id, channelCloseOk, &encoder{})
+	case channelCloseOk:
+		delete(c.channels, id)
+		return nil
+	case exchangeDeclare:
+		d.u16()
+		name, kind := d.shortstr(), d.shortstr()
+		if d.err != nil {
+			return d.err
+		}
+		s.mu.Lock()
+		s.exchanges[name] = kind
+		s.mu.Unlock()
+		return c.method(id, exchangeDeclareOk, &encoder{})
+	case queueDeclare:
+		d.u16()
+		name := d.shortstr()
+		if d.err != nil {
+			return d.err
+		}
+		s.mu.Lock()
+		if _, ok := s.queues[name]; !ok {
+			s.queues[name] = nil
+		}
+		count := len(s.queues[name])
+		s.mu.Unlock()
+		declareOk := &encoder{}
+		declareOk.shortstr(name)
+		declareOk.u32(uint32(count))
+		declareOk.u32(0)
+		return c.method(id, queueDeclareOk, declareOk)
+	case queueBind:
+		d.u16()
+		queue, exchange, key := d.shortstr(), d.shortstr(), d.shortstr()
+		if d.err != nil {
+			return d.err
+		}
+		s.mu.Lock()
+		if s.bindings[exchange] == nil {
+			s.bindings[exchange] = map[string][]string{}
+		}
+		s.bindings[exchange][key] = append(s.bindings[exchange][key], queue)
+		s.mu.Unlock()
+		return c.method(id, queueBindOk, &encoder{})
+	case basicQos:
+		return c.method(id, basicQosOk, &encoder{})
+	case confirmSelect:
+		ch.confirm = true
+		return c.method(id, confirmSelectOk, &encoder{})
+	case basicPublish:
+		d.u16()
+		exchange, key := d.shortstr(), d.shortstr()
+		if d.err != nil {
+			return d.err
+		}
+		ch.publishing = &Message{Exchange: exchange, RoutingKey: key}
+		return nil
+	case basicGet:
+		d.u16()
+		queue := d.shortstr()
+		noAck := d.u8()&1 != 0
+		if d.err != nil {
+			return d.err
+		}
+		return c.get(ch, id, queue, noAck)
+	case basicAck:
+		tag, multiple := d.u64(), d.u8()&1 != 0
+		if d.err != nil {
+			return d.err
+		}
+		c.settle(ch, tag, multiple)
+		return nil
+	case basicNack:
+		tag, bits := d.u64(), d.u8()
+		if d.err != nil {
+			return d.err
+		}
+		if bits&2 != 0 {
+			c.requeue(ch, selectTags(tag, bits&1 != 0))
+		} else {
+			c.settle(ch, tag, bits&1 != 0)
+		}
+		return nil
+	case basicReject:
+		tag, requeue := d.u64(), d.u8()&1 != 0
+		if d.err != nil {
+			return d.err
+		}
+		if requeue {
+			c.requeue(ch, selectTags(tag, false))
+		} else {
+			c.settle(ch, tag, false)
+		}
+		return nil
+	}
+	// Остальные методы тестам не нужны
+	return nil
+}
+
+// published маршрутизирует полностью полученное сообщение и подтверждает его в режиме confirms.
+// Сообщение, которое брокер должен отклонить, не маршрутизируется и получает nack
+func (c *serverConn) published(ch *channel, id uint16) error {
+	message := *ch.publishing
+	ch.publishing = nil
+	c.server.mu.Lock()
+	nack := ch.confirm && (c.server.nackNext > 0 || c.server.nackIf != nil && c.server.nackIf(message))
+	if nack && c.server.nackNext > 0 {
+		c.server.nackNext--
+	}
+	if !nack {
+		c.server.route(message)
+	}
+	c.server.mu.Unlock()
+	if !ch.confirm {
+		return nil
+	}
+	ch.published++
+	confirm := &encoder{}
+	confirm.u64(ch.published)
+	confirm.u8(0)
+	if nack {
+		return c.method(id, basicNack, confirm)
+	}
+	return c.method(id, basicAck, confirm)
+}
+
+// get выдает первое сообщение очереди или basic.get-empty
+func (c *serverConn) get(ch *channel, id uint16, queue string, noAck bool) error {
+	s := c.server
+	s.mu.Lock()
+	messages := s.queues[queue]
+	if len(messages) == 0 {
+		s.mu.Unlock()
+		empty := &encoder{}
+		empty.shortstr("")
+		return c.method(id, basicGetEmpty, empty)
+	}
+	message := messages[0]
+	s.queues[queue] = messages[1:]
+	remaining := len(messages) - 1
+	s.mu.Unlock()
+	ch.deliveryTag++
+	if !noAck {
+		ch.unacked[ch.deliveryTag] = unacked{queue: queue, message: message}
+	}
+	getOk := &encoder{}
+	getOk.u64(ch.deliveryTag)
+	redelivered := byte(0)
+	if message.Redelivered {
+		redelivered = 1
+	}
+	getOk.u8(redelivered)
+	getOk.shortstr(message.Exchange)
+	getOk.shortstr(message.RoutingKey)
+	getOk.u32(uint32(remaining))
+	if err := c.method(id, basicGetOk, getOk); err != nil {
+		return err
+	}
+	header := append([]byte(nil), message.header...)
+	binary.BigEndian.PutUint64(header[4:12], uint64(len(message.Body)))
+	if err := c.frame(frameHeader, id, header); err != nil {
+		return err
+	}
+	for body := message.Body; len(body) > 0; {
+		chunk := body[:min(len(body), frameMax-8)]
+		body = body[len(chunk):]
+		if err := c.frame(frameBody, id, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle удаляет подтвержденные сообщения
+func (c *serverConn) settle(ch *channel, tag uint64, multiple bool) {
+	selected := selectTags(tag, multiple)
+	for unackedTag := range ch.unacked {
+		if selected(unackedTag) {
+			delete(ch.unacked, unackedTag)
+		}
+	}
+}
+
+// requeue возвращает выбранные неподтвержденные сообщения в начало их очередей
+func (c *serverConn) requeue(ch *channel, selected func(uint64) bool) {
+	var tags []uint64
+	for tag := range ch.unacked {
+		if selected(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	// С конца, чтобы сообщения вернулись в исходном порядке
+	slices.Sort(tags)
+	slices.Reverse(tags)
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	for _, tag := range tags {
+		entry := ch.unacked[tag]
+		delete(ch.unacked, tag)
+		entry.message.Redelivered = true
+		c.server.queues[entry.queue] = append([]Message{entry.message}, c.server.queues[entry.queue]...)
+	}
+}
+
+// selectTags выбирает delivery tag или, с multiple, все теги до него включительно
+func selectTags(tag uint64, multiple bool) func(uint64) bool {
+	return func(candidate uint64) bool {
+		return candidate == tag || multiple && (tag == 0 || candidate < tag)
+	}
+}
+
+// method отправляет метод с аргументами args
+func (c *serverConn) method(id uint16, method methodID, args *encoder) error {
+	payload := &encoder{}
+	payload.u16(method.class)
+	payload.u16(method.method)
+	payload.buf.Write(args.buf.Bytes())
+	return c.frame(frameMethod, id, payload.buf.Bytes())
+}
+
+// frame отправляет фрейм
+func (c *serverConn) frame(kind byte, id uint16, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	var header [7]byte
+	header[0] = kind
+	binary.BigEndian.PutUint16(header[1:3], id)
+	binary.BigEndian.PutUint32(header[3:7], uint32(len(payload)))
+	_, _ = c.writer.Write(header[:])
+	_, _ = c.writer.Write(payload)
+	_ = c.writer.WriteByte(frameEnd)
+	return c.writer.Flush()
+}
+
+// readFrame читает один фрейм
+func readFrame(reader *bufio.Reader) (byte, uint16, []byte, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:7])
+	if size > frameMax {
+		return 0, 0, nil, errMalformedFrame
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != frameEnd {
+		return 0, 0, nil, errMalformedFrame
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:size], nil
+}
+
+// encoder собирает аргументы метода
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) u8(v byte) { e.buf.WriteByte(v) }
+
+func (e *encoder) u16(v uint16) { e.buf.Write(binary.BigEndian.AppendUint16(nil, v)) }
+
+func (e *encoder) u32(v uint32) { e.buf.Write(binary.BigEndian.AppendUint32(nil, v)) }
+
+func (e *encoder) u64(v uint64) { e.buf.Write(binary.BigEndian.AppendUint64(nil, v)) }
+
+func (e *encoder) shortstr(v string) {
+	e.u8(byte(len(v)))
+	e.buf.WriteString(v)
+}
+
+func (e *encoder) longstr(v string) {
+	e.u32(uint32(len(v)))
+	e.buf.WriteString(v)
+}
+
+// capabilities записывает server-properties с таблицей capabilities, где все флаги включены
+func (e *encoder) capabilities(names []string) {
+	flags := &encoder{}
+	for _, name := range names {
+		flags.shortstr(name)
+		flags.u8('t')
+		flags.u8(1)
+	}
+	properties := &encoder{}
+	properties.shortstr("capabilities")
+	properties.u8('F')
+	properties.u32(uint32(flags.buf.Len()))
+	properties.buf.Write(flags.buf.Bytes())
+	e.u32(uint32(properties.buf.Len()))
+	e.buf.Write(properties.buf.Bytes())
+}
+
+// decoder читает аргументы метода. После первой нехватки данных все чтения возвращают нули
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.err = errMalformedFrame
+		// Хватает для любого числа, строки при ошибке не используются
+		return make([]byte, min(n, 8))
+	}
+	v := d.data[:n]
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) u8() byte { return d.next(1)[0] }
+
+func (d *decoder) u16() uint16 { return binary.BigEndian.Uint16(d.next(2)) }
+
+func (d *decoder) u32() uint32 { return binary.BigEndian.Uint32(d.next(4)) }
+
+func (d *decoder) u64() uint64 { return binary.BigEndian.Uint64(d.next(8)) }
+
+func (d *decoder) shortstr() string { return string(d.next(int(d.u8()))) }
+
+func (d *decoder) table() { d.next(int(d.u32())) }
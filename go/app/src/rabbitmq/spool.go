@@ -0,0 +1,566 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Политики fsync для спула
+const (
+	// FsyncAlways — fsync после каждой записи, ничего не теряется при падении ОС
+	FsyncAlways = "always"
+	// FsyncInterval — fsync раз в SpoolOptions.FsyncInterval
+	FsyncInterval = "interval"
+	// FsyncNever — полагаемся на page cache ОС
+	FsyncNever = "never"
+)
+
+// ErrSpoolFull возвращается когда спул достиг SpoolOptions.MaxBytes
+var ErrSpoolFull = errors.New("RabbitMQ spool is full")
+
+// Глубина спула публикуется через expvar (/debug/vars) в карте rabbitmq_spool
+var (
+	spoolRecords = new(expvar.Int)
+	spoolBytes   = new(expvar.Int)
+)
+
+func init() {
+	metrics := expvar.NewMap("rabbitmq_spool")
+	metrics.Set("records", spoolRecords)
+	metrics.Set("bytes", spoolBytes)
+}
+
+const (
+	// spoolHeaderSize — длина записи (4 байта) и crc32 тела (4 байта)
+	spoolHeaderSize = 8
+	// spoolCheckpointFile хранит позицию дренажа между перезапусками
+	spoolCheckpointFile = "drain.pos"
+	spoolSegmentPrefix  = "segment-"
+	spoolSegmentSuffix  = ".log"
+)
+
+// SpoolOptions содержит настройки дискового спула
+type SpoolOptions struct {
+	// Dir — каталог для сегментов спула. Пустая строка отключает спул
+	Dir string
+	// Fsync — политика fsync: always, interval или never
+	Fsync string
+	// FsyncInterval — период fsync для политики interval
+	FsyncInterval time.Duration
+	// MaxBytes — максимальный объем неотправленных данных, 0 — без ограничения
+	MaxBytes int64
+	// SegmentBytes — размер сегмента, после которого запись переходит в новый файл
+	SegmentBytes int64
+}
+
+// spoolPosition — позиция дренажа: номер сегмента и смещение внутри него
+type spoolPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// spoolBatch — записи, прочитанные из спула для повторной публикации
+type spoolBatch struct {
+	envelopes []envelope
+	sizes     []int64
+	// segmentDone — прочитан весь сегмент, который больше не пишется
+	segmentDone bool
+}
+
+// spool — append-only журнал сообщений, которые не удалось опубликовать.
+// Записи хранятся в сегментах segment-<номер>.log в порядке добавления,
+// дренаж читает их с позиции read и удаляет полностью отправленные сегменты
+type spool struct {
+	opts SpoolOptions
+	mu   sync.Mutex
+	// writer — текущий сегмент для записи, открывается лениво
+	writer     *os.File
+	writerSeq  uint64
+	writerSize int64
+	read       spoolPosition
+	// records и bytes — глубина спула (еще не отправленные записи)
+	records int64
+	bytes   int64
+	// notify сигнализирует дренажу о новых записях
+	notify chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// openSpool открывает спул в каталоге opts.Dir и восстанавливает позицию дренажа
+func openSpool(opts SpoolOptions) (*spool, error) {
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncAlways
+	}
+	if opts.Fsync != FsyncAlways && opts.Fsync != FsyncInterval && opts.Fsync != FsyncNever {
+		return nil, fmt.Errorf("invalid spool fsync policy %q", opts.Fsync)
+	}
+	if opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = time.Second
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = 64 << 20
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	segments, err := listSegments(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{
+		opts:   opts,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.writerSeq = 1
+	s.read = spoolPosition{Segment: 1}
+	if len(segments) > 0 {
+		// Старые сегменты не дописываем: хвост мог оборваться при падении
+		s.writerSeq = segments[len(segments)-1] + 1
+		s.read = spoolPosition{Segment: segments[0]}
+		if pos, err := s.loadCheckpoint(); err == nil && pos.Segment >= segments[0] {
+			s.read = pos
+		}
+	}
+	// Считаем глубину спула с позиции дренажа
+	for _, seq := range segments {
+		if seq < s.read.Segment {
+			continue
+		}
+		offset := int64(0)
+		if seq == s.read.Segment {
+			offset = s.read.Offset
+		}
+		records, size, err := s.scanSegment(seq, offset)
+		if err != nil {
+			return nil, err
+		}
+		s.records += records
+		s.bytes += size
+	}
+	s.publishMetrics()
+	if s.records > 0 {
+		log.Printf("RabbitMQ spool recovered %d messages (%d bytes) from %s", s.records, s.bytes, opts.Dir)
+	}
+	if opts.Fsync == FsyncInterval {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// listSegments возвращает номера сегментов в каталоге по возрастанию
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix), spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// segmentPath возвращает путь к файлу сегмента
+func (s *spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.opts.Dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, seq, spoolSegmentSuffix))
+}
+
+// scanSegment считает целые записи сегмента начиная со смещения
+func (s *spool) scanSegment(seq uint64, offset int64) (int64, int64, error) {
+	file, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	reader := bufio.NewReader(file)
+	var records, size int64
+	for {
+		_, n, err := readSpoolRecord(reader)
+		if err != nil {
+			return records, size, nil
+		}
+		records++
+		size += n
+	}
+}
+
+// readSpoolRecord читает одну запись. Оборванная или поврежденная запись возвращает ошибку
+func readSpoolRecord(reader *bufio.Reader) ([]byte, int64, error) {
+	var header [spoolHeaderSize]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, errors.New("spool record checksum mismatch")
+	}
+	return payload, int64(spoolHeaderSize + len(payload)), nil
+}
+
+// append добавляет сообщения в конец спула с учетом политики fsync
+func (s *spool) append(envelopes []envelope) error {
+	var data []byte
+	for _, env := range envelopes {
+		payload, err := json.Marshal(env)
+		if err != nil {
+			return fmt.Errorf("failed to encode spool record: %w", err)
+		}
+		var header [spoolHeaderSize]byte
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+		data = append(data, header[:]...)
+		data = append(data, payload...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.MaxBytes > 0 && s.bytes+int64(len(data)) > s.opts.MaxBytes {
+		return ErrSpoolFull
+	}
+	if s.writer == nil || s.writerSize >= s.opts.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	if s.opts.Fsync == FsyncAlways {
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to fsync spool segment: %w", err)
+		}
+	}
+	s.writerSize += int64(len(data))
+	s.records += int64(len(envelopes))
+	s.bytes += int64(len(data))
+	s.publishMetrics()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rotate закрывает текущий сегмент и начинает новый. Вызывается под s.mu
+func (s *spool) rotate() error {
+	if s.writer != nil {
+		if err := s.closeWriter(); err != nil {
+			return err
+		}
+		s.writerSeq++
+	}
+	file, err := os.OpenFile(s.segmentPath(s.writerSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.writer = file
+	s.writerSize = info.Size()
+	return nil
+}
+
+// closeWriter синхронизирует и закрывает текущий сегмент. Вызывается под s.mu
+func (s *spool) closeWriter() error {
+	if s.opts.Fsync != FsyncNever {
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to fsync spool segment: %w", err)
+		}
+	}
+	if err := s.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+	s.writer = nil
+	return nil
+}
+
+// peek читает до limit записей с позиции дренажа, не сдвигая ее
+func (s *spool) peek(limit int) (spoolBatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var batch spoolBatch
+	file, err := os.Open(s.segmentPath(s.read.Segment))
+	if errors.Is(err, os.ErrNotExist) {
+		// Сегмент еще не создан или уже удален
+		batch.segmentDone = s.read.Segment < s.writerSeq
+		return batch, nil
+	}
+	if err != nil {
+		return batch, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := file.Seek(s.read.Offset, io.SeekStart); err != nil {
+		return batch, err
+	}
+	reader := bufio.NewReader(file)
+	for len(batch.envelopes) < limit {
+		payload, size, err := readSpoolRecord(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("RabbitMQ spool segment %d is truncated at offset %d: %v", s.read.Segment, s.read.Offset, err)
+			}
+			// Сегмент закончился; если в него больше не пишут — его можно удалить
+			batch.segmentDone = s.read.Segment < s.writerSeq
+			break
+		}
+		var env envelope
+		if err := json.Unmarshal(payload, &env); err != nil {
+			return batch, fmt.Errorf("failed to decode spool record: %w", err)
+		}
+		batch.envelopes = append(batch.envelopes, env)
+		batch.sizes = append(batch.sizes, size)
+	}
+	return batch, nil
+}
+
+// commit сдвигает позицию дренажа за первые count записей батча
+func (s *spool) commit(batch spoolBatch, count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, size := range batch.sizes[:count] {
+		s.read.Offset += size
+		s.records--
+		s.bytes -= size
+	}
+	if count == len(batch.envelopes) && batch.segmentDone {
+		// Сегмент полностью отправлен — удаляем его
+		if err := os.Remove(s.segmentPath(s.read.Segment)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove spool segment %d: %v", s.read.Segment, err)
+		}
+		s.read = spoolPosition{Segment: s.read.Segment + 1}
+	}
+	s.publishMetrics()
+	return s.saveCheckpoint()
+}
+
+// loadCheckpoint читает сохраненную позицию дренажа
+func (s *spool) loadCheckpoint() (spoolPosition, error) {
+	var pos spoolPosition
+	data, err := os.ReadFile(filepath.Join(s.opts.Dir, spoolCheckpointFile))
+	if err != nil {
+		return pos, err
+	}
+	err = json.Unmarshal(data, &pos)
+	return pos, err
+}
+
+// saveCheckpoint атомарно сохраняет позицию дренажа. Вызывается под s.mu
+func (s *spool) saveCheckpoint() error {
+	data, err := json.Marshal(s.read)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.opts.Dir, spoolCheckpointFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// depth возвращает количество и объем неотправленных записей
+func (s *spool) depth() (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records, s.bytes
+}
+
+// publishMetrics обновляет expvar метрики. Вызывается под s.mu
+func (s *spool) publishMetrics() {
+	spoolRecords.Set(s.records)
+	spoolBytes.Set(s.bytes)
+}
+
+// syncLoop периодически делает fsync текущего сегмента (политика interval)
+func (s *spool) syncLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.FsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.writer != nil {
+				if err := s.writer.Sync(); err != nil {
+					log.Printf("Failed to fsync spool segment: %v", err)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close останавливает фоновую синхронизацию и закрывает текущий сегмент
+func (s *spool) close() error {
+	close(s.done)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return nil
+	}
+	return s.closeWriter()
+}
+
+// spoolDrainBatch — сколько записей дренаж публикует за один проход
+const spoolDrainBatch = 100
+
+// spoolable сообщает, что публикация не удалась из-за временной недоступности брокера
+// и ее имеет смысл повторить из спула. Nack брокера и отмена запроса в спул не попадают:
+// повтор nack ничего не изменит, а отмененный запрос клиент повторит сам
+func spoolable(err error) bool {
+	return errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrPublishFailed) ||
+		errors.Is(err, ErrConfirmTimeout) ||
+		errors.Is(err, ErrConfirmLost) ||
+		errors.Is(err, ErrBlocked) ||
+		errors.Is(err, ErrCircuitOpen)
+}
+
+// spoolFailed сохраняет в спул сообщения, которые не удалось опубликовать из-за недоступности брокера.
+// Сохраненные сообщения считаются принятыми, их ошибки сбрасываются
+func (c *Client) spoolFailed(envelopes []envelope, results []error) {
+	var failed []envelope
+	var indexes []int
+	for i, err := range results {
+		if spoolable(err) {
+			failed = append(failed, envelopes[i])
+			indexes = append(indexes, i)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	if err := c.spool.append(failed); err != nil {
+		log.Printf("Failed to spool %d messages: %v", len(failed), err)
+		return
+	}
+	log.Printf("Spooled %d messages that could not be published: %v", len(failed), results[indexes[0]])
+	for _, i := range indexes {
+		results[i] = nil
+	}
+}
+
+// drain по порядку публикует сообщения из спула, пока клиент не закрыт.
+// Позиция сдвигается только за непрерывный префикс обработанных записей:
+// отправленных или отклоненных брокером, которые повторять бесполезно
+func (c *Client) drain() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.done
+		cancel()
+	}()
+	for {
+		batch, err := c.spool.peek(spoolDrainBatch)
+		if err != nil {
+			log.Printf("Failed to read RabbitMQ spool: %v", err)
+			if !c.sleep(time.Second) {
+				return
+			}
+			continue
+		}
+		if len(batch.envelopes) == 0 {
+			if batch.segmentDone {
+				if err := c.spool.commit(batch, 0); err != nil {
+					log.Printf("Failed to advance RabbitMQ spool: %v", err)
+				}
+				continue
+			}
+			// Спул пуст — ждем новых записей
+			select {
+			case <-c.spool.notify:
+			case <-c.done:
+				return
+			}
+			continue
+		}
+		results := c.send(ctx, batch.envelopes)
+		processed, dropped := 0, 0
+		var dropErr error
+		for ; processed < len(results); processed++ {
+			err := results[processed]
+			if err == nil {
+				continue
+			}
+			// Брокер недоступен или клиент закрывается — запись остается в спуле
+			if spoolable(err) || ctx.Err() != nil {
+				break
+			}
+			// Запись отклонена брокером: повтор ничего не изменит, а остальные записи она бы задержала
+			dropped++
+			dropErr = err
+		}
+		if dropped > 0 {
+			log.Printf("Dropped %d spooled messages rejected by RabbitMQ: %v", dropped, dropErr)
+		}
+		if processed > 0 {
+			if err := c.spool.commit(batch, processed); err != nil {
+				log.Printf("Failed to advance RabbitMQ spool: %v", err)
+			}
+			records, _ := c.spool.depth()
+			log.Printf("Replayed %d spooled messages, %d remaining", processed-dropped, records)
+		}
+		if processed < len(results) {
+			// Брокер все еще недоступен — повторим с первой неотправленной записи
+			if !c.sleep(time.Second) {
+				return
+			}
+		}
+	}
+}
+
+// sleep ждет d и возвращает false если клиент закрыли раньше
+func (c *Client) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
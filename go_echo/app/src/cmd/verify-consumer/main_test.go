@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go_echo/models"
+	"github.com/ex10se/http-perf-test/go_echo/rabbitmq"
+	"github.com/ex10se/http-perf-test/go_echo/rabbitmq/amqptest"
+)
+
+// idle — сколько verify ждет новых сообщений в тестах
+const idle = 200 * time.Millisecond
+
+// publish декларирует топологию и публикует сообщения через клиент сервиса
+func publish(t *testing.T, server *amqptest.Server, topology *rabbitmq.Topology, messages []rabbitmq.Message) {
+	t.Helper()
+	client, err := rabbitmq.New(rabbitmq.Options{
+		URLs:        []string{server.URL()},
+		Confirm:     true,
+		PoolSize:    1,
+		ConnectWait: 5 * time.Second,
+		Topology:    topology,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	if err := client.DeclareQueues(); err != nil {
+		t.Fatal(err)
+	}
+	for i, err := range client.PublishBatch(context.Background(), messages) {
+		if err != nil {
+			t.Fatalf("failed to publish message %d: %v", i, err)
+		}
+	}
+}
+
+func newMessage(t *testing.T, router *rabbitmq.Router, event models.StatusEvent) rabbitmq.Message {
+	t.Helper()
+	message, err := rabbitmq.NewMessage(&event, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func runVerify(t *testing.T, server *amqptest.Server, topology *rabbitmq.Topology, router *rabbitmq.Router, requeue bool) *report {
+	t.Helper()
+	conn, err := rabbitmq.Dial(server.URL(), rabbitmq.TLSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	r, err := verify(conn, topology, router, idle, requeue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// defaultMessages — корректное событие, его повтор, системное событие в чужой очереди и не-JSON тело
+func defaultMessages(t *testing.T, router *rabbitmq.Router) []rabbitmq.Message {
+	event := models.StatusEvent{TxID: "tx-1", State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z"}
+	system := models.StatusEvent{TxID: "tx-2", State: "FAILED", UpdatedAt: "2024-05-01T12:00:01Z", TrackData: &models.TrackData{IsSystem: true}}
+	misrouted := newMessage(t, router, system)
+	misrouted.RoutingKey = rabbitmq.QueueGolang
+	return []rabbitmq.Message{
+		newMessage(t, router, event),
+		newMessage(t, router, event),
+		newMessage(t, router, system),
+		misrouted,
+		{RoutingKey: rabbitmq.QueueGolang, Body: []byte("not json")},
+	}
+}
+
+func checkReport(t *testing.T, r *report, total, malformed, misrouted, duplicates int) {
+	t.Helper()
+	if r.total != total || r.malformed != malformed || r.misrouted != misrouted || r.duplicates != duplicates {
+		t.Errorf("report: total %d, malformed %d, misrouted %d, duplicates %d; want %d, %d, %d, %d",
+			r.total, r.malformed, r.misrouted, r.duplicates, total, malformed, misrouted, duplicates)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	topology, router, err := loadTopology("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, server, topology, defaultMessages(t, router))
+	r := runVerify(t, server, topology, router, false)
+	// tx-2 встречается дважды: в своей очереди и в чужой
+	checkReport(t, r, 5, 1, 1, 2)
+	for _, queue := range []string{rabbitmq.QueueGolang, rabbitmq.QueueSystemGolang} {
+		if messages := server.Messages(queue); len(messages) != 0 {
+			t.Errorf("%d messages left in %s after acknowledging", len(messages), queue)
+		}
+	}
+}
+
+// TestVerifyRequeue проверяет, что с -requeue каждое сообщение читается один раз
+// и после проверки остается в очереди
+func TestVerifyRequeue(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	topology, router, err := loadTopology("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, server, topology, defaultMessages(t, router))
+	for pass := 0; pass < 2; pass++ {
+		r := runVerify(t, server, topology, router, true)
+		checkReport(t, r, 5, 1, 1, 2)
+	}
+	if messages := server.Messages(rabbitmq.QueueGolang); len(messages) != 4 {
+		t.Errorf("%d messages in %s after requeue, want 4", len(messages), rabbitmq.QueueGolang)
+	}
+}
+
+func TestVerifyTopologyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	data := `
+exchange: events
+exchanges:
+  - name: events
+    type: direct
+queues:
+  - name: events
+  - name: errors
+bindings:
+  - queue: events
+    exchange: events
+    routing_key: events
+  - queue: errors
+    exchange: events
+    routing_key: errors
+routing:
+  rules:
+    - match: {has_error: true}
+      routing_key: errors
+  default:
+    routing_key: events
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	topology, router, err := loadTopology(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := amqptest.NewServer()
+	defer server.Close()
+	failed := models.StatusEvent{TxID: "tx-1", State: "FAILED", UpdatedAt: "2024-05-01T12:00:00Z", Error: &models.ErrorData{}}
+	success := models.StatusEvent{TxID: "tx-2", State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:01Z"}
+	misrouted := newMessage(t, router, success)
+	misrouted.RoutingKey = "errors"
+	publish(t, server, topology, []rabbitmq.Message{
+		newMessage(t, router, failed),
+		newMessage(t, router, success),
+		misrouted,
+	})
+	r := runVerify(t, server, topology, router, false)
+	checkReport(t, r, 3, 0, 1, 1)
+	if r.perQueue["events"] != 1 || r.perQueue["errors"] != 2 {
+		t.Errorf("per queue = %v, want events 1, errors 2", r.perQueue)
+	}
+}
+
+// TestVerifyDeadLetter проверяет, что сообщения dead-letter очередей не считаются неправильно маршрутизированными
+func TestVerifyDeadLetter(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	topology := rabbitmq.DefaultTopology(rabbitmq.QueueOptions{DeadLetter: true})
+	router := rabbitmq.DefaultRouter(0)
+	system := models.StatusEvent{TxID: "tx-2", State: "FAILED", UpdatedAt: "2024-05-01T12:00:01Z", TrackData: &models.TrackData{IsSystem: true}}
+	// Так брокер перекладывает отклоненное сообщение из очереди go
+	rejected := newMessage(t, router, system)
+	rejected.Exchange = rabbitmq.DeadLetterExchangeName
+	rejected.RoutingKey = rabbitmq.QueueGolang
+	publish(t, server, topology, []rabbitmq.Message{newMessage(t, router, system), rejected})
+	r := runVerify(t, server, topology, router, false)
+	checkReport(t, r, 2, 0, 0, 0)
+	if r.deadLettered != 1 || r.perQueue[rabbitmq.QueueGolang+rabbitmq.DeadLetterQueueSuffix] != 1 {
+		t.Errorf("dead-lettered %d, per queue %v; want 1 in %s", r.deadLettered, r.perQueue, rabbitmq.QueueGolang+rabbitmq.DeadLetterQueueSuffix)
+	}
+}
+
+func TestDeadLetterQueues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	data := `
+exchange: events
+exchanges:
+  - name: events
+    type: direct
+  - name: parking
+    type: fanout
+  - name: retry
+    type: direct
+queues:
+  - name: events
+    arguments:
+      x-dead-letter-exchange: parking
+  - name: errors
+    arguments:
+      x-dead-letter-exchange: retry
+      x-dead-letter-routing-key: errors-retry
+  - name: parked
+  - name: errors-retry
+  - name: unrelated
+  - name: audit.dlq
+bindings:
+  - queue: events
+    exchange: events
+    routing_key: events
+  - queue: errors
+    exchange: events
+    routing_key: errors
+  - queue: parked
+    exchange: parking
+  - queue: errors-retry
+    exchange: retry
+    routing_key: errors-retry
+  - queue: unrelated
+    exchange: retry
+    routing_key: unrelated
+routing:
+  default:
+    routing_key: events
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	topology, _, err := loadTopology(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := deadLetterQueues(topology)
+	want := map[string]bool{"parked": true, "errors-retry": true, "audit.dlq": true}
+	if len(got) != len(want) {
+		t.Errorf("deadLetterQueues() = %v, want %v", got, want)
+	}
+	for queue := range want {
+		if !got[queue] {
+			t.Errorf("%s is not a dead-letter queue", queue)
+		}
+	}
+}
@@ -3,8 +3,11 @@ module github.com/ex10se/http-perf-test/go_echo
 go 1.25
 
 require (
+	github.com/klauspost/compress v1.18.2
 	github.com/labstack/echo/v4 v4.14.0
+	github.com/pierrec/lz4/v4 v4.1.31
 	github.com/rabbitmq/amqp091-go v1.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,225 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go_echo/rabbitmq"
+)
+
+// ErrQueueFull — в очереди асинхронной публикации нет места для всех событий запроса
+var ErrQueueFull = errors.New("publish queue is full")
+
+// ErrClosed — публикатор остановлен и больше не принимает события
+var ErrClosed = errors.New("publisher is closed")
+
+// Метрики очереди публикуются через expvar (/debug/vars) в карте publisher_async
+var (
+	asyncDepth     = new(expvar.Int)
+	asyncPublished = new(expvar.Int)
+	asyncFailed    = new(expvar.Int)
+	asyncRejected  = new(expvar.Int)
+)
+
+func init() {
+	metrics := expvar.NewMap("publisher_async")
+	metrics.Set("depth", asyncDepth)
+	metrics.Set("published", asyncPublished)
+	metrics.Set("failed", asyncFailed)
+	metrics.Set("rejected", asyncRejected)
+}
+
+// AsyncOptions содержит настройки асинхронной публикации
+type AsyncOptions struct {
+	// QueueSize — сколько событий помещается в очередь
+	QueueSize int
+	// Workers — количество горутин, которые публикуют события из очереди
+	Workers int
+	// BatchSize — сколько событий воркер забирает из очереди за одну публикацию
+	BatchSize int
+	// DrainTimeout ограничивает дочитывание очереди при остановке, 0 — без ограничения.
+	// По истечении публикации отменяются, и неотправленные события теряются
+	DrainTimeout time.Duration
+}
+
+// Async ставит события в ограниченную очередь в памяти, из которой их публикуют воркеры.
+// Хэндлер отвечает сразу после Enqueue, не дожидаясь брокера, а результат публикации
+// узнает через колбэк Enqueue. События, которые не удалось опубликовать, только логируются:
+// чтобы не терять их при недоступности RabbitMQ, нужен спул (RABBITMQ_SPOOL_DIR)
+type Async struct {
+	next  Publisher
+	opts  AsyncOptions
+	queue chan queued
+	// mu делает постановку всех событий запроса атомарной и защищает closed
+	mu     sync.Mutex
+	closed bool
+	// ctx отменяется когда истек DrainTimeout
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ Publisher = (*Async)(nil)
+
+// queued — событие в очереди и колбэк, которому воркер сообщит результат его публикации
+type queued struct {
+	message rabbitmq.Message
+	index   int
+	done    func(int, error)
+}
+
+// NewAsync запускает воркеры, которые публикуют события через next
+func NewAsync(next Publisher, opts AsyncOptions) *Async {
+	opts.QueueSize = max(opts.QueueSize, 1)
+	opts.Workers = max(opts.Workers, 1)
+	opts.BatchSize = max(opts.BatchSize, 1)
+	a := &Async{
+		next:  next,
+		opts:  opts,
+		queue: make(chan queued, opts.QueueSize),
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	for i := 0; i < opts.Workers; i++ {
+		a.wg.Add(1)
+		go a.worker()
+	}
+	return a
+}
+
+// Enqueue ставит в очередь все события запроса или ни одного.
+// Возвращает ErrQueueFull если места не хватает и ErrClosed после Close.
+// done, если не nil, воркер вызывает для каждого поставленного события
+// с его индексом в messages и результатом публикации
+func (a *Async) Enqueue(messages []rabbitmq.Message, done func(int, error)) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	// Канал пополняется только под mu, поэтому проверенное место не займут
+	if len(a.queue)+len(messages) > cap(a.queue) {
+		asyncRejected.Add(int64(len(messages)))
+		return ErrQueueFull
+	}
+	for i, message := range messages {
+		a.queue <- queued{message: message, index: i, done: done}
+	}
+	asyncDepth.Add(int64(len(messages)))
+	return nil
+}
+
+func (a *Async) Publish(ctx context.Context, routingKey string, body []byte) error {
+	return a.PublishBatch(ctx, []rabbitmq.Message{{RoutingKey: routingKey, Body: body}})[0]
+}
+
+// PublishBatch ставит сообщения в очередь и возвращает для всех результат Enqueue
+func (a *Async) PublishBatch(_ context.Context, messages []rabbitmq.Message) []error {
+	results := make([]error, len(messages))
+	if err := a.Enqueue(messages, nil); err != nil {
+		for i := range results {
+			results[i] = err
+		}
+	}
+	return results
+}
+
+// Health возвращает ErrClosed после Close, иначе состояние бэкенда
+func (a *Async) Health(ctx context.Context) error {
+	a.mu.Lock()
+	closed := a.closed
+	a.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	return a.next.Health(ctx)
+}
+
+// Close перестает принимать события, дожидается публикации очереди
+// (не дольше DrainTimeout) и закрывает бэкенд
+func (a *Async) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+	log.Printf("Draining publish queue: %d events", len(a.queue))
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if a.opts.DrainTimeout > 0 {
+		timer := time.NewTimer(a.opts.DrainTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+		log.Println("Publish queue drained")
+	case <-timeout:
+		log.Printf("Publish queue was not drained in %v, cancelling publishes", a.opts.DrainTimeout)
+		a.cancel()
+		<-done
+	}
+	a.cancel()
+	return a.next.Close()
+}
+
+// worker публикует события из очереди пачками до ее закрытия
+func (a *Async) worker() {
+	defer a.wg.Done()
+	batch := make([]queued, 0, a.opts.BatchSize)
+	messages := make([]rabbitmq.Message, 0, a.opts.BatchSize)
+	for item := range a.queue {
+		batch = append(batch[:0], item)
+		// Добираем то, что уже лежит в очереди, не дожидаясь новых событий
+	fill:
+		for len(batch) < a.opts.BatchSize {
+			select {
+			case item, ok := <-a.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, item)
+			default:
+				break fill
+			}
+		}
+		asyncDepth.Add(-int64(len(batch)))
+		messages = messages[:0]
+		for _, item := range batch {
+			messages = append(messages, item.message)
+		}
+		a.publish(batch, messages)
+	}
+}
+
+// publish отправляет сообщения пачки через бэкенд, учитывает результат и сообщает его колбэкам
+func (a *Async) publish(batch []queued, messages []rabbitmq.Message) {
+	failed := 0
+	var firstErr error
+	for i, err := range a.next.PublishBatch(a.ctx, messages) {
+		if item := batch[i]; item.done != nil {
+			item.done(item.index, err)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	asyncPublished.Add(int64(len(batch) - failed))
+	if failed > 0 {
+		asyncFailed.Add(int64(failed))
+		log.Printf("Failed to publish %d of %d queued events: %v", failed, len(batch), firstErr)
+	}
+}
@@ -0,0 +1,23 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/ex10se/http-perf-test/go_echo/rabbitmq"
+)
+
+// Discard принимает и отбрасывает все сообщения.
+// Нужен чтобы измерить накладные расходы HTTP слоя без брокера
+type Discard struct{}
+
+var _ Publisher = Discard{}
+
+func (Discard) Publish(context.Context, string, []byte) error { return nil }
+
+func (Discard) PublishBatch(_ context.Context, messages []rabbitmq.Message) []error {
+	return make([]error, len(messages))
+}
+
+func (Discard) Health(context.Context) error { return nil }
+
+func (Discard) Close() error { return nil }
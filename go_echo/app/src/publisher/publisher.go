@@ -0,0 +1,69 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ex10se/http-perf-test/go_echo/config"
+	"github.com/ex10se/http-perf-test/go_echo/rabbitmq"
+)
+
+// Publisher отправляет события дальше по конвейеру.
+// Хэндлеры зависят только от этого интерфейса, конкретный бэкенд выбирается конфигурацией
+type Publisher interface {
+	// Publish отправляет одно сообщение
+	Publish(ctx context.Context, routingKey string, body []byte) error
+	// PublishBatch отправляет сообщения одного запроса и возвращает ошибку для каждого, nil — успех
+	PublishBatch(ctx context.Context, messages []rabbitmq.Message) []error
+	// Health возвращает ошибку если бэкенд сейчас не может принимать сообщения
+	Health(ctx context.Context) error
+	// Close освобождает ресурсы бэкенда
+	Close() error
+}
+
+// Названия бэкендов для PUBLISHER_BACKEND
+const (
+	BackendRabbitMQ = "rabbitmq"
+	BackendDiscard  = "discard"
+	BackendMemory   = "memory"
+)
+
+// New создает бэкенд, выбранный в cfg.PublisherBackend, и при cfg.AsyncPublish
+// оборачивает его в Async.
+// topology — топология RabbitMQ из файла, nil — топология по умолчанию
+func New(cfg *config.Config, topology *rabbitmq.Topology) (Publisher, error) {
+	backend, err := newBackend(cfg, topology)
+	if err != nil || !cfg.AsyncPublish {
+		return backend, err
+	}
+	return NewAsync(backend, AsyncOptions{
+		QueueSize:    cfg.AsyncQueueSize,
+		Workers:      cfg.AsyncWorkers,
+		BatchSize:    cfg.AsyncBatchSize,
+		DrainTimeout: cfg.AsyncDrainTimeout,
+	}), nil
+}
+
+// newBackend создает бэкенд, выбранный в cfg.PublisherBackend
+func newBackend(cfg *config.Config, topology *rabbitmq.Topology) (Publisher, error) {
+	switch cfg.PublisherBackend {
+	case BackendRabbitMQ:
+		return newRabbitMQ(cfg, topology)
+	case BackendDiscard:
+		return Discard{}, nil
+	case BackendMemory:
+		// Memory раскладывает сообщения по очередям той же топологии, что декларировал бы RabbitMQ
+		if topology == nil {
+			topology = rabbitmq.DefaultTopology(queueOptions(cfg))
+		}
+		return NewMemory(MemoryOptions{
+			FailureRate: cfg.MemoryFailureRate,
+			NackRate:    cfg.MemoryNackRate,
+			Latency:     cfg.MemoryLatency,
+			Capacity:    cfg.MemoryCapacity,
+			Topology:    topology,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown publisher backend %q", cfg.PublisherBackend)
+	}
+}
@@ -0,0 +1,100 @@
+package rabbitmq
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrBlocked — брокер приостановил публикацию (connection.blocked из-за memory или disk alarm)
+var ErrBlocked = errors.New("RabbitMQ connection is blocked")
+
+// BlockedError возвращается пока брокер держит соединение заблокированным.
+// errors.Is(err, ErrBlocked) возвращает true
+type BlockedError struct {
+	// Reason — причина из connection.blocked, например "low on memory"
+	Reason string
+	// RetryAfter — через сколько имеет смысл повторить запрос
+	RetryAfter time.Duration
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrBlocked, e.Reason)
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// blockedRetryAfter — подсказка клиентам в Retry-After: сколько продлится alarm заранее неизвестно
+const blockedRetryAfter = 5 * time.Second
+
+// blockedConnections публикует в /debug/vars количество заблокированных соединений
+var blockedConnections = new(expvar.Int)
+
+func init() {
+	expvar.Publish("rabbitmq_blocked_connections", blockedConnections)
+}
+
+// watchBlocked отслеживает connection.blocked/unblocked соединения conn до его закрытия
+func (c *connection) watchBlocked(conn *amqp.Connection, node string, blockings <-chan amqp.Blocking) {
+	for blocking := range blockings {
+		c.mu.Lock()
+		// Уведомление от уже замененного соединения
+		if c.conn != conn {
+			c.mu.Unlock()
+			continue
+		}
+		if blocking.Active {
+			log.Printf("RabbitMQ node %s blocked connection %d: %s", node, c.id, blocking.Reason)
+			c.setBlocked(blocking.Reason)
+		} else {
+			log.Printf("RabbitMQ node %s unblocked connection %d after %v", node, c.id, time.Since(c.blockedAt).Round(time.Millisecond))
+			c.setUnblocked()
+		}
+		c.mu.Unlock()
+	}
+}
+
+// setBlocked помечает соединение заблокированным, вызывается под c.mu
+func (c *connection) setBlocked(reason string) {
+	if !c.blocked {
+		blockedConnections.Add(1)
+		c.blockedAt = time.Now()
+	}
+	c.blocked = true
+	c.blockedReason = reason
+}
+
+// setUnblocked снимает блокировку, вызывается под c.mu
+func (c *connection) setUnblocked() {
+	if c.blocked {
+		blockedConnections.Add(-1)
+	}
+	c.blocked = false
+	c.blockedReason = ""
+}
+
+// blockedErr возвращает BlockedError если брокер заблокировал соединение
+func (c *connection) blockedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.blocked {
+		return nil
+	}
+	return &BlockedError{Reason: c.blockedReason, RetryAfter: blockedRetryAfter}
+}
+
+// Blocked сообщает, заблокировал ли брокер хотя бы одно соединение клиента
+func (c *Client) Blocked() bool {
+	for _, conn := range c.conns {
+		if conn.blockedErr() != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -1,208 +1,585 @@
 package rabbitmq
 
 import (
-	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/ex10se/http-perf-test/go_echo/models"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// Client представляет подключение к RabbitMQ с автоматическим переподключением
-type Client struct {
-	url       string
-	conn      *amqp.Connection
-	channel   *amqp.Channel
-	mu        sync.Mutex
-	connected bool
+// ErrNacked возвращается когда брокер отклонил сообщение (basic.nack) в режиме подтверждений
+var ErrNacked = errors.New("message was nacked by RabbitMQ")
+
+// ErrConfirmTimeout возвращается когда подтверждение от брокера не пришло вовремя
+var ErrConfirmTimeout = errors.New("timed out waiting for RabbitMQ confirmation")
+
+// ErrConfirmLost возвращается когда канал закрылся раньше, чем пришло подтверждение.
+// Брокер мог сохранить сообщение, а мог и нет
+var ErrConfirmLost = errors.New("channel closed before RabbitMQ confirmed the message")
+
+// ErrPublishFailed возвращается когда публикация не удалась за все повторы
+var ErrPublishFailed = errors.New("failed to publish message")
+
+// ErrUnavailable возвращается когда соединение с брокером отсутствует
+// и не восстановилось за Options.ConnectWait. Хэндлеры отвечают на нее 503
+var ErrUnavailable = errors.New("RabbitMQ is unavailable")
+
+// startupWait ограничивает ожидание первого подключения при декларации очередей
+const startupWait = 30 * time.Second
+
+// DefaultPoolSize — размер пула каналов по умолчанию
+const DefaultPoolSize = 16
+
+// Options содержит настройки RabbitMQ клиента
+type Options struct {
+	// URLs — узлы кластера, к которым клиент подключается по очереди
+	URLs []string
+	// Failover — порядок перебора узлов: FailoverRoundRobin (по умолчанию) или FailoverPriority
+	Failover string
+	// TLS — сертификаты для узлов amqps:// и SASL EXTERNAL
+	TLS TLSOptions
+	// Confirm переводит канал в режим publisher confirms:
+	// Publish возвращает успех только после basic.ack от брокера
+	Confirm bool
+	// ConfirmTimeout ограничивает ожидание подтверждения
+	ConfirmTimeout time.Duration
+	// PoolSize — количество AMQP каналов, которые используются параллельно
+	PoolSize int
+	// Connections — количество TCP соединений, между которыми распределяются каналы пула
+	Connections int
+	// ConnectWait — сколько Publish ждет восстановления соединения
+	// прежде чем вернуть ErrUnavailable. 0 — не ждать вовсе
+	ConnectWait time.Duration
+	// Codec сжимает тела сообщений, по умолчанию gzip
+	Codec Codec
+	// CompressMinSize — тела меньше этого размера (в байтах) публикуются без сжатия
+	CompressMinSize int
+	// Spool — дисковый спул для сообщений, которые не удалось опубликовать
+	Spool SpoolOptions
+	// Queues — аргументы декларации очередей для топологии по умолчанию
+	Queues QueueOptions
+	// Topology — топология брокера из файла, nil — DefaultTopology(Queues)
+	Topology *Topology
+	// DefaultPriority — приоритет сообщений без trackData.priority
+	DefaultPriority int
+	// Breaker — circuit breaker публикации, по умолчанию выключен
+	Breaker BreakerOptions
 }
 
-// New создает новый RabbitMQ клиент
-func New(url string) *Client {
-	return &Client{
-		url:       url,
-		connected: false,
+// QueueOptions содержит аргументы, с которыми декларируются очереди
+type QueueOptions struct {
+	// DeadLetter создает DeadLetterExchangeName и очередь <queue>.dlq для каждой очереди
+	DeadLetter bool
+	// MessageTTL — x-message-ttl, 0 — без ограничения
+	MessageTTL time.Duration
+	// MaxLength — x-max-length, 0 — без ограничения
+	MaxLength int
+	// Overflow — x-overflow при достижении MaxLength: drop-head, reject-publish, reject-publish-dlx.
+	// Quorum очереди не поддерживают reject-publish-dlx
+	Overflow string
+	// Type — тип очередей по умолчанию: classic, quorum или stream
+	Type string
+	// Types переопределяет тип для отдельных очередей: имя очереди → тип
+	Types map[string]string
+	// DeliveryLimit — x-delivery-limit для quorum очередей, 0 — значение брокера
+	DeliveryLimit int
+	// InitialGroupSize — x-quorum-initial-group-size для quorum очередей, 0 — значение брокера
+	InitialGroupSize int
+	// MaxAge — x-max-age для stream очередей, например "7D", пусто — без ограничения
+	MaxAge string
+	// Shards — количество шардов каждой очереди "<queue>.<shard>", 0 или 1 — без шардирования
+	Shards int
+	// MaxPriority — x-max-priority для classic очередей, 0 — очереди без приоритетов.
+	// Приоритеты сообщений выше MaxPriority понижаются до него
+	MaxPriority int
+}
+
+// Типы очередей RabbitMQ
+const (
+	QueueTypeClassic = "classic"
+	QueueTypeQuorum  = "quorum"
+	QueueTypeStream  = "stream"
+)
+
+// Значения x-overflow — поведение очереди при достижении x-max-length
+const (
+	OverflowDropHead         = "drop-head"
+	OverflowRejectPublish    = "reject-publish"
+	OverflowRejectPublishDLX = "reject-publish-dlx"
+)
+
+// queueType возвращает тип очереди с учетом переопределений
+func (o QueueOptions) queueType(queueName string) string {
+	if queueType, ok := o.Types[queueName]; ok {
+		return queueType
+	}
+	if o.Type == "" {
+		return QueueTypeClassic
 	}
+	return o.Type
 }
 
-// connect устанавливает соединение с RabbitMQ
-func (c *Client) connect() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var err error
-	c.conn, err = amqp.Dial(c.url)
-	if err != nil {
-		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+// validate проверяет что все типы очередей известны
+func (o QueueOptions) validate() error {
+	types := []string{o.Type}
+	for _, queueType := range o.Types {
+		types = append(types, queueType)
 	}
-	c.channel, err = c.conn.Channel()
-	if err != nil {
-		_ = c.conn.Close()
-		return fmt.Errorf("failed to open channel: %w", err)
+	for _, queueType := range types {
+		switch queueType {
+		case "", QueueTypeClassic, QueueTypeQuorum, QueueTypeStream:
+		default:
+			return fmt.Errorf("unknown queue type %q", queueType)
+		}
+	}
+	if o.Shards < 0 {
+		return fmt.Errorf("shards must not be negative, got %d", o.Shards)
+	}
+	if o.MaxPriority < 0 || o.MaxPriority > models.MaxPriority {
+		return fmt.Errorf("max priority must be between 0 and %d, got %d", models.MaxPriority, o.MaxPriority)
 	}
-	c.connected = true
-	log.Println("Connected to RabbitMQ")
 	return nil
 }
 
-// isConnected проверяет активно ли подключение
-func (c *Client) isConnected() bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if !c.connected {
-		return false
+// TopologyMismatchError возвращается когда exchange или очередь уже существуют
+// с другими аргументами и брокер ответил PRECONDITION_FAILED
+type TopologyMismatchError struct {
+	Kind   string
+	Name   string
+	Reason string
+}
+
+func (e *TopologyMismatchError) Error() string {
+	return fmt.Sprintf("%s %q already exists with different arguments (%s): delete it or align the configuration with the existing one", e.Kind, e.Name, e.Reason)
+}
+
+// topologyError превращает PRECONDITION_FAILED в TopologyMismatchError
+func topologyError(kind, name string, err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return &TopologyMismatchError{Kind: kind, Name: name, Reason: amqpErr.Reason}
+	}
+	return fmt.Errorf("failed to declare %s %s: %w", kind, name, err)
+}
+
+// Client представляет пул каналов RabbitMQ с автоматическим переподключением в фоне
+type Client struct {
+	opts  Options
+	conns []*connection
+	pool  chan *pooledChannel
+	// spool — nil если спул отключен
+	spool   *spool
+	breaker *breaker
+	// done закрывается в Close и останавливает горутины переподключения
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New создает новый RabbitMQ клиент
+// Возвращает ошибку если настройки некорректны или не удалось открыть спул
+func New(opts Options) (*Client, error) {
+	if err := opts.Queues.validate(); err != nil {
+		return nil, err
+	}
+	if len(opts.URLs) == 0 {
+		return nil, fmt.Errorf("at least one RabbitMQ URL is required")
+	}
+	switch opts.Failover {
+	case "":
+		opts.Failover = FailoverRoundRobin
+	case FailoverRoundRobin, FailoverPriority:
+	default:
+		return nil, fmt.Errorf("unknown failover mode %q", opts.Failover)
+	}
+	if opts.DefaultPriority < 0 || opts.DefaultPriority > models.MaxPriority {
+		return nil, fmt.Errorf("default priority must be between 0 and %d, got %d", models.MaxPriority, opts.DefaultPriority)
+	}
+	if opts.Topology == nil {
+		opts.Topology = DefaultTopology(opts.Queues)
+	}
+	if err := opts.Topology.validate(); err != nil {
+		return nil, err
+	}
+	if opts.ConfirmTimeout <= 0 {
+		opts.ConfirmTimeout = 5 * time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = DefaultPoolSize
+	}
+	if opts.Codec == nil {
+		opts.Codec = newGzipCodec(gzip.DefaultCompression)
+	}
+	if opts.Connections <= 0 {
+		opts.Connections = 1
+	}
+	// Соединений без каналов не бывает
+	if opts.Connections > opts.PoolSize {
+		opts.Connections = opts.PoolSize
+	}
+	config, err := dialConfig(opts.TLS)
+	if err != nil {
+		return nil, err
 	}
-	if c.conn == nil || c.conn.IsClosed() {
-		c.connected = false
-		return false
+	if opts.Breaker.CoolDown <= 0 {
+		opts.Breaker.CoolDown = 5 * time.Second
 	}
-	if c.channel == nil {
-		c.connected = false
-		return false
+	conns, pool := newPool(opts.URLs, opts.Failover, config, opts.PoolSize, opts.Connections)
+	c := &Client{
+		opts:    opts,
+		conns:   conns,
+		pool:    pool,
+		breaker: &breaker{opts: opts.Breaker, now: time.Now},
+		done:    make(chan struct{}),
 	}
-	return true
+	if opts.Spool.Dir != "" {
+		s, err := openSpool(opts.Spool)
+		if err != nil {
+			return nil, err
+		}
+		c.spool = s
+	}
+	// Подключаемся в фоне
+	for _, conn := range c.conns {
+		c.wg.Add(1)
+		go func(conn *connection) {
+			defer c.wg.Done()
+			conn.supervise(c.done)
+		}(conn)
+	}
+	// Отправляем накопленное в спуле после восстановления соединения
+	if c.spool != nil {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.drain()
+		}()
+	}
+	return c, nil
 }
 
-// ensureConnected проверяет подключение и переподключается если нужно
-func (c *Client) ensureConnected() error {
-	if c.isConnected() {
-		return nil
+// encode сжимает тело сообщения выбранным кодеком
+// Тела короче CompressMinSize публикуются без сжатия: маленькие события после gzip только растут
+func (c *Client) encode(body []byte) ([]byte, string, error) {
+	if len(body) < c.opts.CompressMinSize {
+		return body, "", nil
 	}
-	// Retry логика с exponential backoff
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		if err := c.connect(); err == nil {
-			return nil
-		}
-		// Exponential backoff: 1s, 2s, 4s, 8s, 16s
-		waitTime := time.Duration(1<<uint(i)) * time.Second
-		log.Printf("Failed to connect to RabbitMQ, retrying in %v (attempt %d/%d)", waitTime, i+1, maxRetries)
-		time.Sleep(waitTime)
+	encoded, err := c.opts.Codec.Encode(body)
+	if err != nil {
+		return nil, "", err
 	}
-	return fmt.Errorf("failed to connect to RabbitMQ after %d attempts", maxRetries)
+	return encoded, c.opts.Codec.Encoding(), nil
 }
 
-// compressMessage сжимает сообщение с помощью gzip
-func compressMessage(data []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	gzipWriter := gzip.NewWriter(&buf)
-	if _, err := gzipWriter.Write(data); err != nil {
-		return nil, err
+// priority возвращает AMQP приоритет сообщения: DefaultPriority если он не задан,
+// не выше MaxPriority если очереди декларируются с приоритетами
+func (c *Client) priority(priority *uint8) uint8 {
+	value := c.opts.DefaultPriority
+	if priority != nil {
+		value = int(*priority)
 	}
-	if err := gzipWriter.Close(); err != nil {
-		return nil, err
+	if c.opts.Queues.MaxPriority > 0 {
+		value = min(value, c.opts.Queues.MaxPriority)
 	}
-	return buf.Bytes(), nil
+	return uint8(value)
 }
 
-// DeclareQueues создает exchange и очереди в RabbitMQ
+// DeclareQueues применяет топологию брокера: exchanges, очереди и привязки.
+// Декларации идемпотентны, поэтому повторный запуск ничего не меняет
 func (c *Client) DeclareQueues() error {
-	if err := c.ensureConnected(); err != nil {
+	pc, err := c.acquire(context.Background(), startupWait)
+	if err != nil {
 		return err
 	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	// Декларируем exchange
-	err := c.channel.ExchangeDeclare(
-		ExchangeName, // name
-		"direct",     // type
-		true,         // durable
-		false,        // auto-deleted
-		false,        // internal
-		false,        // no-wait
-		nil,          // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare exchange: %w", err)
-	}
-	// Декларируем очереди
-	queues := []string{QueueGolang, QueueSystemGolang}
-	for _, queueName := range queues {
-		_, err := c.channel.QueueDeclare(
-			queueName, // name
-			true,      // durable
-			false,     // delete when unused
-			false,     // exclusive
-			false,     // no-wait
-			nil,       // arguments
-		)
-		if err != nil {
-			return fmt.Errorf("failed to declare queue %s: %w", queueName, err)
-		}
-		// Привязываем очередь к exchange
-		err = c.channel.QueueBind(
-			queueName,    // queue name
-			queueName,    // routing key
-			ExchangeName, // exchange
-			false,        // no-wait
-			nil,          // arguments
-		)
-		if err != nil {
-			return fmt.Errorf("failed to bind queue %s: %w", queueName, err)
-		}
+	defer c.release(pc)
+	if err := c.opts.Topology.apply(pc); err != nil {
+		return err
 	}
-	log.Println("Queues and exchange declared successfully")
+	log.Printf("Topology declared: %d exchanges, %d queues, %d bindings",
+		len(c.opts.Topology.Exchanges), len(c.opts.Topology.Queues), len(c.opts.Topology.Bindings))
 	return nil
 }
 
+// queueArguments собирает x-аргументы очереди из QueueOptions с учетом ее типа.
+// Stream очереди не поддерживают dead-lettering, TTL сообщений и x-max-length, поэтому они пропускаются
+func (o QueueOptions) queueArguments(queueName string) map[string]any {
+	queueType := o.queueType(queueName)
+	args := map[string]any{}
+	switch queueType {
+	case QueueTypeQuorum:
+		args["x-queue-type"] = QueueTypeQuorum
+		if o.DeliveryLimit > 0 {
+			args["x-delivery-limit"] = int64(o.DeliveryLimit)
+		}
+		if o.InitialGroupSize > 0 {
+			args["x-quorum-initial-group-size"] = int64(o.InitialGroupSize)
+		}
+	case QueueTypeStream:
+		args["x-queue-type"] = QueueTypeStream
+		if o.MaxAge != "" {
+			args["x-max-age"] = o.MaxAge
+		}
+		return args
+	}
+	if o.DeadLetter {
+		args["x-dead-letter-exchange"] = DeadLetterExchangeName
+		args["x-dead-letter-routing-key"] = queueName
+	}
+	if o.MessageTTL > 0 {
+		args["x-message-ttl"] = o.MessageTTL.Milliseconds()
+	}
+	if o.MaxLength > 0 {
+		args["x-max-length"] = int64(o.MaxLength)
+	}
+	if o.Overflow != "" {
+		args["x-overflow"] = o.Overflow
+	}
+	// Приоритеты поддерживают только classic очереди
+	if o.MaxPriority > 0 && queueType == QueueTypeClassic {
+		args["x-max-priority"] = int64(o.MaxPriority)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
 // Publish отправляет сообщение в RabbitMQ с автоматическим переподключением
-func (c *Client) Publish(queueName string, body []byte) error {
-	// Сжимаем сообщение
-	compressed, err := compressMessage(body)
-	if err != nil {
-		return fmt.Errorf("failed to compress message: %w", err)
+// Каждая публикация захватывает свой канал из пула, поэтому вызовы выполняются параллельно.
+// Отмена или дедлайн ctx прерывают повторы, паузы между ними и ожидание переподключения
+func (c *Client) Publish(ctx context.Context, queueName string, body []byte) error {
+	return c.PublishBatch(ctx, []Message{{RoutingKey: queueName, Body: body}})[0]
+}
+
+// PublishBatch публикует сообщения одного запроса через один канал пула.
+// Сообщения отправляются подряд без ожидания, подтверждения (если включены)
+// ожидаются вместе после возврата канала в пул.
+// Неотправленные сообщения сохраняются в спул, если он включен.
+// Возвращает ошибку для каждого сообщения в том же порядке, nil — успех.
+// ctx обычно контекст HTTP запроса: после его отмены публикация не продолжается
+func (c *Client) PublishBatch(ctx context.Context, messages []Message) []error {
+	results := make([]error, len(messages))
+	// Например, все события запроса оказались повторами. Пустой батч не должен
+	// занимать канал и засчитываться breaker как успешная публикация
+	if len(messages) == 0 {
+		return results
 	}
-	// Retry логика для публикации
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		if err := c.ensureConnected(); err != nil {
-			return err
+	envelopes := make([]envelope, 0, len(messages))
+	positions := make([]int, 0, len(messages))
+	// Сжимаем сообщения до захвата канала
+	for i, message := range messages {
+		body, encoding, err := c.encode(message.Body)
+		if err != nil {
+			results[i] = fmt.Errorf("failed to compress message: %w", err)
+			continue
 		}
-		c.mu.Lock()
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		err = c.channel.PublishWithContext(
-			ctx,
-			ExchangeName, // exchange
-			queueName,    // routing key
-			false,        // mandatory
-			false,        // immediate
-			amqp.Publishing{
+		envelopes = append(envelopes, envelope{
+			Exchange:   message.Exchange,
+			RoutingKey: message.RoutingKey,
+			Publishing: amqp.Publishing{
 				ContentType:     "application/json",
-				ContentEncoding: "gzip",
+				ContentEncoding: encoding,
 				DeliveryMode:    amqp.Persistent,
-				Body:            compressed,
+				MessageId:       message.MessageID,
+				Timestamp:       message.Timestamp,
+				Type:            message.Type,
+				AppId:           AppID,
+				Priority:        c.priority(message.Priority),
+				Headers:         message.Headers,
+				Body:            body,
 			},
+		})
+		positions = append(positions, i)
+	}
+	sent := c.send(ctx, envelopes)
+	if c.spool != nil {
+		c.spoolFailed(envelopes, sent)
+	}
+	for k, err := range sent {
+		results[positions[k]] = err
+	}
+	return results
+}
+
+// send публикует подготовленные сообщения с повторами и ожиданием подтверждений
+func (c *Client) send(ctx context.Context, envelopes []envelope) []error {
+	results := make([]error, len(envelopes))
+	// Breaker разомкнут — не тратим время запроса на заведомо неудачные повторы
+	if err := c.breaker.allow(); err != nil {
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+	pending := make([]int, len(envelopes))
+	for i := range pending {
+		pending[i] = i
+	}
+	confirmations := make([]*amqp.DeferredConfirmation, len(envelopes))
+	// Retry логика для публикации: повторяем только неотправленный остаток
+	maxRetries := 5
+	var err error
+	for attempt := 0; attempt < maxRetries && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			sleepContext(ctx, time.Second)
+		}
+		// Клиент отключился или истек дедлайн запроса — повторять незачем
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			for _, i := range pending {
+				results[i] = ctxErr
+			}
+			pending = nil
+			break
+		}
+		pc, acquireErr := c.acquire(ctx, c.opts.ConnectWait)
+		if acquireErr == nil {
+			// acquire отдает слот заблокированного соединения только когда заблокированы все:
+			// публикация зависнет до снятия alarm, а соединения живые и переподключаться незачем
+			if acquireErr = pc.conn.blockedErr(); acquireErr != nil {
+				c.release(pc)
+			}
+		}
+		if acquireErr != nil {
+			// Брокер недоступен — не держим запрос, переподключение идет в фоне
+			for _, i := range pending {
+				results[i] = acquireErr
+			}
+			pending = nil
+			break
+		}
+		var sent []int
+		sent, pending, err = c.publishPending(ctx, pc, envelopes, pending, confirmations)
+		// Подтверждения ждем пока слот наш: закрытие канала другим запросом после его ошибки
+		// заставило бы amqp091 отклонить сообщения, которые брокер уже сохранил
+		if c.opts.Confirm {
+			c.waitConfirms(ctx, pc, sent, confirmations, results)
+		}
+		if err != nil {
+			// Канал после ошибки непригоден — заменяем только его
+			log.Printf("Failed to publish message on channel %d: %v, retrying...", pc.id, err)
+			pc.discard()
+		}
+		c.release(pc)
+	}
+	for _, i := range pending {
+		results[i] = fmt.Errorf("%w after %d attempts: %w", ErrPublishFailed, maxRetries, err)
+	}
+	c.breaker.record(results)
+	return results
+}
+
+// publishPending отправляет сообщения с индексами pending через канал слота.
+// Возвращает индексы отправленных сообщений и, при ошибке, оставшихся неотправленными
+func (c *Client) publishPending(
+	ctx context.Context,
+	pc *pooledChannel,
+	envelopes []envelope,
+	pending []int,
+	confirmations []*amqp.DeferredConfirmation,
+) (sent, rest []int, err error) {
+	for k, i := range pending {
+		exchange := envelopes[i].Exchange
+		if exchange == "" {
+			exchange = c.opts.Topology.Exchange
+		}
+		confirmation, err := pc.channel.PublishWithDeferredConfirmWithContext(
+			ctx,
+			exchange,                // exchange
+			envelopes[i].RoutingKey, // routing key
+			false,                   // mandatory
+			false,                   // immediate
+			envelopes[i].Publishing,
 		)
-		cancel()
-		c.mu.Unlock()
-		if err == nil {
-			return nil
+		if err != nil {
+			return pending[:k], pending[k:], err
 		}
-		log.Printf("Failed to publish message: %v, retrying...", err)
-		c.connected = false // Помечаем что нужно переподключение
-		time.Sleep(time.Second)
+		confirmations[i] = confirmation
 	}
-	return fmt.Errorf("failed to publish message after %d attempts: %w", maxRetries, err)
+	return pending, nil, nil
 }
 
-// Close закрывает соединение с RabbitMQ
-func (c *Client) Close() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.channel != nil {
-		if err := c.channel.Close(); err != nil {
-			log.Printf("Error closing channel: %v", err)
+// waitConfirms ожидает basic.ack/basic.nack для сообщений sent, отправленных через канал слота,
+// с общим дедлайном ConfirmTimeout и записывает результат в results
+func (c *Client) waitConfirms(parent context.Context, pc *pooledChannel, sent []int, confirmations []*amqp.DeferredConfirmation, results []error) {
+	ctx, cancel := context.WithTimeout(parent, c.opts.ConfirmTimeout)
+	defer cancel()
+	for _, i := range sent {
+		acked, err := confirmations[i].WaitContext(ctx)
+		switch {
+		case err != nil && parent.Err() != nil:
+			// Запрос отменен раньше, чем истек ConfirmTimeout
+			results[i] = parent.Err()
+		case err != nil:
+			results[i] = ErrConfirmTimeout
+		case !acked && pc.channel.IsClosed():
+			// Закрывая канал, amqp091 отклоняет все неподтвержденные сообщения,
+			// поэтому такой nack не означает отказ брокера
+			results[i] = ErrConfirmLost
+		case !acked:
+			results[i] = ErrNacked
+		}
+	}
+	// Подтверждения не пришли потому что брокер заблокировал соединение во время публикации
+	if blockedErr := pc.conn.blockedErr(); blockedErr != nil {
+		for _, i := range sent {
+			if errors.Is(results[i], ErrConfirmTimeout) {
+				results[i] = blockedErr
+			}
+		}
+	}
+}
+
+// sleepContext ждет d или отмены ctx
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Health возвращает nil если хотя бы одно соединение с брокером установлено и не заблокировано,
+// а circuit breaker не разомкнут
+func (c *Client) Health(ctx context.Context) error {
+	if err := c.breaker.check(); err != nil {
+		return err
+	}
+	var blockedErr error
+	for _, conn := range c.conns {
+		if _, err := conn.get(ctx, 0); err != nil {
+			continue
 		}
+		if err := conn.blockedErr(); err != nil {
+			blockedErr = err
+			continue
+		}
+		return nil
 	}
-	if c.conn != nil {
-		if err := c.conn.Close(); err != nil {
-			log.Printf("Error closing connection: %v", err)
+	if blockedErr != nil {
+		return blockedErr
+	}
+	return ErrUnavailable
+}
+
+// Close закрывает все соединения с RabbitMQ
+// Каналы пула закрываются вместе со своими соединениями
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+	if c.spool != nil {
+		if err := c.spool.close(); err != nil {
+			log.Printf("Error closing RabbitMQ spool: %v", err)
 		}
 	}
-	c.connected = false
 	log.Println("RabbitMQ connection closed")
 	return nil
 }
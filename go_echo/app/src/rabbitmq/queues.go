@@ -4,12 +4,13 @@ const (
 	ExchangeName      = "go-echo"
 	QueueGolang       = "go-echo"
 	QueueSystemGolang = "system-go-echo"
+	// AppID проставляется в свойство app_id сообщений, чтобы отличать варианты сервиса
+	AppID = "go-echo"
 )
 
-// GetQueueName возвращает название очереди в зависимости от типа события
-func GetQueueName(isSystem bool) string {
-	if isSystem {
-		return QueueSystemGolang
-	}
-	return QueueGolang
-}
+const (
+	// DeadLetterExchangeName — exchange для отклоненных и просроченных сообщений
+	DeadLetterExchangeName = ExchangeName + ".dlx"
+	// DeadLetterQueueSuffix добавляется к имени очереди для ее dead-letter очереди
+	DeadLetterQueueSuffix = ".dlq"
+)
@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/ex10se/http-perf-test/go_echo/models"
+)
+
+func TestRouterRoute(t *testing.T) {
+	router := &Router{
+		Rules: []Rule{
+			{Match: Match{HasError: ptr(true)}, Route: Route{RoutingKey: "errors"}},
+			{Match: Match{Channel: []string{"email", "sms"}, State: []string{"SUCCESS"}}, Route: Route{RoutingKey: "notifications"}},
+			{Match: Match{ChannelID: []string{"42"}}, Route: Route{Exchange: "vip", RoutingKey: "vip"}},
+			{Match: Match{MinPriority: ptr(5), MaxPriority: ptr(9)}, Route: Route{RoutingKey: "urgent"}},
+			{Match: Match{IsSystem: ptr(true)}, Route: Route{RoutingKey: QueueSystemGolang}},
+		},
+		Default: &Route{RoutingKey: QueueGolang},
+	}
+	tests := []struct {
+		name  string
+		event models.StatusEvent
+		want  Route
+	}{
+		{name: "no rule matches", event: models.StatusEvent{State: "SUCCESS"}, want: Route{RoutingKey: QueueGolang}},
+		{name: "first matching rule wins",
+			event: models.StatusEvent{State: "SUCCESS", Error: &models.ErrorData{}, Channel: ptr("email")},
+			want:  Route{RoutingKey: "errors"}},
+		{name: "all conditions of a rule must match",
+			event: models.StatusEvent{State: "FAILED", Channel: ptr("email")},
+			want:  Route{RoutingKey: QueueGolang}},
+		{name: "any value of a list matches",
+			event: models.StatusEvent{State: "SUCCESS", Channel: ptr("sms")},
+			want:  Route{RoutingKey: "notifications"}},
+		{name: "route exchange", event: models.StatusEvent{ChannelID: ptr("42")}, want: Route{Exchange: "vip", RoutingKey: "vip"}},
+		{name: "priority range is inclusive",
+			event: models.StatusEvent{TrackData: &models.TrackData{Priority: ptr(9), IsSystem: true}},
+			want:  Route{RoutingKey: "urgent"}},
+		{name: "priority outside the range",
+			event: models.StatusEvent{TrackData: &models.TrackData{Priority: ptr(10), IsSystem: true}},
+			want:  Route{RoutingKey: QueueSystemGolang}},
+		{name: "priority rule skips events without priority",
+			event: models.StatusEvent{TrackData: &models.TrackData{IsSystem: true}},
+			want:  Route{RoutingKey: QueueSystemGolang}},
+	}
+	for _, tt := range tests {
+		if got := router.Route(&tt.event); got != tt.want {
+			t.Errorf("%s: Route() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRouteKey(t *testing.T) {
+	event := &models.StatusEvent{TxID: "tx-1"}
+	if got := (Route{RoutingKey: QueueGolang, Shards: 1}).key(event); got != QueueGolang {
+		t.Errorf("key() without shards = %q, want %q", got, QueueGolang)
+	}
+	route := Route{RoutingKey: QueueGolang, Shards: 4}
+	if got, want := route.key(event), ShardQueueName(QueueGolang, shardOf("tx-1", 4)); got != want {
+		t.Errorf("key() = %q, want %q", got, want)
+	}
+	if keys := route.keys(); len(keys) != 4 || keys[0] != QueueGolang+".0" || keys[3] != QueueGolang+".3" {
+		t.Errorf("keys() = %v", keys)
+	}
+}
@@ -0,0 +1,91 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TLSOptions содержит настройки TLS для узлов amqps://
+type TLSOptions struct {
+	// CAFile — PEM файл с сертификатами CA, пусто — системные корневые сертификаты
+	CAFile string
+	// CertFile и KeyFile — клиентский сертификат и ключ в PEM для взаимной аутентификации
+	CertFile string
+	KeyFile  string
+	// ServerName — имя сервера для проверки сертификата, пусто — хост из URL
+	ServerName string
+	// External включает SASL EXTERNAL: брокер аутентифицирует клиента по сертификату,
+	// логин и пароль из URL не используются
+	External bool
+}
+
+// enabled возвращает true если задана хотя бы одна настройка TLS
+func (o TLSOptions) enabled() bool {
+	return o.CAFile != "" || o.CertFile != "" || o.KeyFile != "" || o.ServerName != ""
+}
+
+// tlsConfig собирает tls.Config из файлов CA и клиентского сертификата
+func (o TLSOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: o.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// dialConfig собирает amqp.Config для всех соединений клиента.
+// TLS применяется только к узлам со схемой amqps://
+func dialConfig(opts TLSOptions) (amqp.Config, error) {
+	config := amqp.Config{
+		Locale: "en_US",
+	}
+	if opts.enabled() {
+		tlsConfig, err := opts.tlsConfig()
+		if err != nil {
+			return amqp.Config{}, err
+		}
+		config.TLSClientConfig = tlsConfig
+	}
+	if opts.External {
+		if opts.CertFile == "" {
+			return amqp.Config{}, fmt.Errorf("SASL EXTERNAL requires a client certificate")
+		}
+		config.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	}
+	return config, nil
+}
+
+// Dial открывает отдельное соединение с настройками TLS и SASL клиента,
+// например для утилит, которым не нужен пул каналов
+func Dial(url string, opts TLSOptions) (*amqp.Connection, error) {
+	config, err := dialConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return amqp.DialConfig(url, config)
+}
@@ -0,0 +1,364 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Topology описывает exchanges, очереди и привязки, которые клиент декларирует при старте.
+// Загружается из YAML/JSON файла (JSON — подмножество YAML):
+//
+//	exchange: go
+//	exchanges:
+//	  - name: go
+//	    type: direct
+//	queues:
+//	  - name: go
+//	    arguments:
+//	      x-queue-type: quorum
+//	bindings:
+//	  - queue: go
+//	    exchange: go
+//	    routing_key: go
+//	routing:
+//	  default:
+//	    routing_key: go
+//
+// Без секции routing события маршрутизируются DefaultRouter,
+// и его ключи тоже должны доходить до очередей топологии
+type Topology struct {
+	// Exchange — exchange, в который публикуются события
+	Exchange  string         `yaml:"exchange" json:"exchange"`
+	Exchanges []ExchangeSpec `yaml:"exchanges" json:"exchanges"`
+	Queues    []QueueSpec    `yaml:"queues" json:"queues"`
+	Bindings  []BindingSpec  `yaml:"bindings" json:"bindings"`
+	// Routing — правила выбора exchange и ключа маршрутизации, nil — DefaultRouter
+	Routing *Router `yaml:"routing" json:"routing"`
+}
+
+// ExchangeSpec описывает exchange
+type ExchangeSpec struct {
+	Name string `yaml:"name" json:"name"`
+	// Type — direct, fanout, topic, headers или тип плагина x-*
+	Type string `yaml:"type" json:"type"`
+	// Durable по умолчанию true
+	Durable    *bool          `yaml:"durable" json:"durable"`
+	AutoDelete bool           `yaml:"auto_delete" json:"auto_delete"`
+	Internal   bool           `yaml:"internal" json:"internal"`
+	Arguments  map[string]any `yaml:"arguments" json:"arguments"`
+}
+
+// QueueSpec описывает очередь
+type QueueSpec struct {
+	Name string `yaml:"name" json:"name"`
+	// Durable по умолчанию true
+	Durable    *bool          `yaml:"durable" json:"durable"`
+	AutoDelete bool           `yaml:"auto_delete" json:"auto_delete"`
+	Exclusive  bool           `yaml:"exclusive" json:"exclusive"`
+	Arguments  map[string]any `yaml:"arguments" json:"arguments"`
+}
+
+// BindingSpec привязывает очередь к exchange по ключу маршрутизации
+type BindingSpec struct {
+	Queue      string         `yaml:"queue" json:"queue"`
+	Exchange   string         `yaml:"exchange" json:"exchange"`
+	RoutingKey string         `yaml:"routing_key" json:"routing_key"`
+	Arguments  map[string]any `yaml:"arguments" json:"arguments"`
+}
+
+// LoadTopology читает топологию из YAML или JSON файла
+func LoadTopology(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology file: %w", err)
+	}
+	topology := &Topology{}
+	if err := yaml.Unmarshal(data, topology); err != nil {
+		return nil, fmt.Errorf("failed to parse topology file %s: %w", path, err)
+	}
+	if topology.Exchange == "" {
+		topology.Exchange = ExchangeName
+	}
+	if err := topology.validate(); err != nil {
+		return nil, fmt.Errorf("invalid topology file %s: %w", path, err)
+	}
+	return topology, nil
+}
+
+// DefaultTopology строит топологию из констант queues.go и QueueOptions:
+// direct exchange с двумя очередями и, если включен dead-lettering, DLX с очередями <queue>.dlq.
+// С шардированием вместо каждой очереди создаются Shards очередей <queue>.<shard>,
+// а dead-letter очередь остается одна на все шарды
+func DefaultTopology(opts QueueOptions) *Topology {
+	topology := &Topology{Exchange: ExchangeName}
+	queues := []string{QueueGolang, QueueSystemGolang}
+	// Dead-letter exchange и очереди декларируются до основных, чтобы сообщения не терялись
+	if opts.DeadLetter {
+		topology.Exchanges = append(topology.Exchanges, ExchangeSpec{Name: DeadLetterExchangeName, Type: amqp.ExchangeDirect})
+		for _, queueName := range queues {
+			// У stream очередей нет dead-lettering
+			if opts.queueType(queueName) == QueueTypeStream {
+				continue
+			}
+			dlq := queueName + DeadLetterQueueSuffix
+			topology.Queues = append(topology.Queues, QueueSpec{Name: dlq})
+			topology.Bindings = append(topology.Bindings, BindingSpec{Queue: dlq, Exchange: DeadLetterExchangeName, RoutingKey: queueName})
+		}
+	}
+	topology.Exchanges = append(topology.Exchanges, ExchangeSpec{Name: ExchangeName, Type: amqp.ExchangeDirect})
+	for _, queueName := range queues {
+		names := []string{queueName}
+		if opts.Shards > 1 {
+			names = names[:0]
+			for shard := 0; shard < opts.Shards; shard++ {
+				names = append(names, ShardQueueName(queueName, shard))
+			}
+		}
+		// Аргументы общие для всех шардов, в том числе dead-letter ключ исходной очереди
+		args := opts.queueArguments(queueName)
+		for _, name := range names {
+			topology.Queues = append(topology.Queues, QueueSpec{Name: name, Arguments: args})
+			topology.Bindings = append(topology.Bindings, BindingSpec{Queue: name, Exchange: ExchangeName, RoutingKey: name})
+		}
+	}
+	return topology
+}
+
+// validate проверяет имена, типы exchanges и что привязки и маршруты ссылаются на объявленные объекты.
+// Предопределенные exchanges amq.* и "" можно использовать без объявления
+func (t *Topology) validate() error {
+	exchanges := map[string]bool{"": true}
+	for _, exchange := range t.Exchanges {
+		if exchange.Name == "" {
+			return fmt.Errorf("exchange name is required")
+		}
+		switch exchange.Type {
+		case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders:
+		default:
+			if !strings.HasPrefix(exchange.Type, "x-") {
+				return fmt.Errorf("exchange %s has unknown type %q", exchange.Name, exchange.Type)
+			}
+		}
+		exchanges[exchange.Name] = true
+	}
+	queues := map[string]bool{}
+	for _, queue := range t.Queues {
+		if queue.Name == "" {
+			return fmt.Errorf("queue name is required")
+		}
+		if err := validateOverflow(queue); err != nil {
+			return fmt.Errorf("queue %s: %w", queue.Name, err)
+		}
+		queues[queue.Name] = true
+	}
+	declared := func(name string) bool {
+		return exchanges[name] || strings.HasPrefix(name, "amq.")
+	}
+	for _, binding := range t.Bindings {
+		if !queues[binding.Queue] {
+			return fmt.Errorf("binding references undeclared queue %q", binding.Queue)
+		}
+		if binding.Exchange == "" || !declared(binding.Exchange) {
+			return fmt.Errorf("binding of queue %s references undeclared exchange %q", binding.Queue, binding.Exchange)
+		}
+	}
+	if !declared(t.Exchange) {
+		return fmt.Errorf("publish exchange %q is not declared", t.Exchange)
+	}
+	if t.Routing != nil {
+		if err := t.Routing.validate(declared); err != nil {
+			return err
+		}
+		return t.CheckRouting(t.Routing)
+	}
+	return nil
+}
+
+// validateOverflow проверяет x-overflow очереди с учетом ее типа:
+// stream очереди его не поддерживают, quorum — не поддерживают reject-publish-dlx
+func validateOverflow(queue QueueSpec) error {
+	overflow, ok := queue.Arguments["x-overflow"]
+	if !ok {
+		return nil
+	}
+	queueType, _ := queue.Arguments["x-queue-type"].(string)
+	switch overflow {
+	case OverflowDropHead, OverflowRejectPublish:
+	case OverflowRejectPublishDLX:
+		if queueType == QueueTypeQuorum {
+			return fmt.Errorf("x-overflow %q is not supported by quorum queues", overflow)
+		}
+	default:
+		return fmt.Errorf("unknown x-overflow %v, want %s, %s or %s", overflow, OverflowDropHead, OverflowRejectPublish, OverflowRejectPublishDLX)
+	}
+	if queueType == QueueTypeStream {
+		return fmt.Errorf("x-overflow is not supported by stream queues")
+	}
+	return nil
+}
+
+// CheckRouting проверяет, что каждый ключ маршрутизации router доходит хотя бы до одной очереди топологии.
+// Публикация идет без mandatory, поэтому сообщение без подходящей привязки брокер молча отбросит.
+// Exchanges типов headers и x-* и exchanges с alternate-exchange не проверяются
+func (t *Topology) CheckRouting(router *Router) error {
+	for _, route := range router.routes() {
+		exchange := route.Exchange
+		if exchange == "" {
+			exchange = t.Exchange
+		}
+		for _, key := range route.keys() {
+			if queues, known := t.Destinations(exchange, key); known && len(queues) == 0 {
+				return fmt.Errorf("routing: routing key %q does not reach any queue through exchange %q", key, exchange)
+			}
+		}
+	}
+	return nil
+}
+
+// Destinations возвращает очереди топологии, в которые exchange доставит сообщение с ключом key
+// ("" — default exchange). false означает, что маршрутизацию exchange определить нельзя
+func (t *Topology) Destinations(exchange, key string) ([]string, bool) {
+	// Default exchange доставляет в очередь, имя которой совпадает с ключом
+	if exchange == "" {
+		if slices.ContainsFunc(t.Queues, func(queue QueueSpec) bool { return queue.Name == key }) {
+			return []string{key}, true
+		}
+		return nil, true
+	}
+	kind := t.exchangeType(exchange)
+	if kind != amqp.ExchangeDirect && kind != amqp.ExchangeFanout && kind != amqp.ExchangeTopic {
+		return nil, false
+	}
+	var queues []string
+	for _, binding := range t.Bindings {
+		if binding.Exchange != exchange || slices.Contains(queues, binding.Queue) {
+			continue
+		}
+		switch {
+		case kind == amqp.ExchangeFanout,
+			kind == amqp.ExchangeDirect && binding.RoutingKey == key,
+			kind == amqp.ExchangeTopic && topicMatches(strings.Split(binding.RoutingKey, "."), strings.Split(key, ".")):
+			queues = append(queues, binding.Queue)
+		}
+	}
+	return queues, true
+}
+
+// exchangeType возвращает тип exchange для проверки маршрутов.
+// Пустая строка — маршрутизацию exchange проверить нельзя
+func (t *Topology) exchangeType(name string) string {
+	for _, exchange := range t.Exchanges {
+		if exchange.Name != name {
+			continue
+		}
+		// Неподошедшие сообщения уходят в alternate exchange
+		if _, ok := exchange.Arguments["alternate-exchange"]; ok {
+			return ""
+		}
+		return exchange.Type
+	}
+	// Предопределенные exchanges брокера
+	switch name {
+	case "amq.direct":
+		return amqp.ExchangeDirect
+	case "amq.fanout":
+		return amqp.ExchangeFanout
+	case "amq.topic":
+		return amqp.ExchangeTopic
+	}
+	return ""
+}
+
+// topicMatches сопоставляет слова ключа со словами шаблона привязки topic exchange:
+// * заменяет ровно одно слово, # — ноль или больше слов
+func topicMatches(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if topicMatches(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && topicMatches(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && topicMatches(pattern[1:], key[1:])
+	}
+}
+
+// apply декларирует exchanges, затем очереди, затем привязки в порядке описания
+func (t *Topology) apply(pc *pooledChannel) error {
+	for _, exchange := range t.Exchanges {
+		err := pc.channel.ExchangeDeclare(
+			exchange.Name,             // name
+			exchange.Type,             // type
+			durable(exchange.Durable), // durable
+			exchange.AutoDelete,       // auto-deleted
+			exchange.Internal,         // internal
+			false,                     // no-wait
+			table(exchange.Arguments), // arguments
+		)
+		if err != nil {
+			pc.discard()
+			return topologyError("exchange", exchange.Name, err)
+		}
+	}
+	for _, queue := range t.Queues {
+		_, err := pc.channel.QueueDeclare(
+			queue.Name,             // name
+			durable(queue.Durable), // durable
+			queue.AutoDelete,       // delete when unused
+			queue.Exclusive,        // exclusive
+			false,                  // no-wait
+			table(queue.Arguments), // arguments
+		)
+		if err != nil {
+			pc.discard()
+			return topologyError("queue", queue.Name, err)
+		}
+	}
+	for _, binding := range t.Bindings {
+		err := pc.channel.QueueBind(
+			binding.Queue,            // queue name
+			binding.RoutingKey,       // routing key
+			binding.Exchange,         // exchange
+			false,                    // no-wait
+			table(binding.Arguments), // arguments
+		)
+		if err != nil {
+			pc.discard()
+			return fmt.Errorf("failed to bind queue %s to exchange %s: %w", binding.Queue, binding.Exchange, err)
+		}
+	}
+	return nil
+}
+
+// durable возвращает значение флага durable, по умолчанию true
+func durable(value *bool) bool {
+	return value == nil || *value
+}
+
+// table превращает аргументы из файла в amqp.Table.
+// YAML декодирует вложенные объекты в map[string]any, а AMQP ожидает amqp.Table
+func table(args map[string]any) amqp.Table {
+	if len(args) == 0 {
+		return nil
+	}
+	result := amqp.Table{}
+	for key, value := range args {
+		if nested, ok := value.(map[string]any); ok {
+			value = table(nested)
+		}
+		result[key] = value
+	}
+	return result
+}
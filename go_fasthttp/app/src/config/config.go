@@ -3,20 +3,178 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config содержит конфигурацию приложения
 type Config struct {
-	RabbitMQURL string
-	SocketPath  string
+	// PublisherBackend — куда отправляются события: rabbitmq, memory или discard
+	PublisherBackend string
+	// MemoryFailureRate, MemoryNackRate и MemoryLatency — сбои, которые вносит бэкенд memory
+	MemoryFailureRate float64
+	MemoryNackRate    float64
+	MemoryLatency     time.Duration
+	// MemoryCapacity — сколько последних сообщений на очередь хранит бэкенд memory
+	MemoryCapacity int
+	// AsyncPublish включает асинхронную публикацию: хэндлер ставит события в очередь и отвечает 202
+	AsyncPublish bool
+	// AsyncQueueSize — сколько событий помещается в очередь асинхронной публикации
+	AsyncQueueSize int
+	// AsyncWorkers — количество воркеров, публикующих события из очереди
+	AsyncWorkers int
+	// AsyncBatchSize — сколько событий воркер публикует за раз
+	AsyncBatchSize int
+	// AsyncDrainTimeout ограничивает дочитывание очереди при остановке, 0 — без ограничения
+	AsyncDrainTimeout time.Duration
+	// DedupTTL — сколько помнить принятое событие (txId, state, updatedAt), 0 — дедупликация выключена
+	DedupTTL time.Duration
+	// DedupCapacity — сколько событий помнит кэш дедупликации
+	DedupCapacity int
+	// DedupShards — количество шардов кэша дедупликации
+	DedupShards int
+	// IdempotencyTTL — сколько хранится ответ на запрос с Idempotency-Key, 0 — заголовок игнорируется
+	IdempotencyTTL time.Duration
+	// IdempotencyCapacity — сколько ответов хранится одновременно
+	IdempotencyCapacity int
+	// MetricsAddr — внутренний TCP адрес для метрик expvar (/debug/vars), пусто — метрики не отдаются.
+	// Метрики не публикуются на сокете, который проксирует nginx
+	MetricsAddr string
+	// RabbitMQURLs — узлы кластера RabbitMQ, в DSN__RABBITMQ перечисляются через запятую
+	RabbitMQURLs []string
+	SocketPath   string
+	// RabbitMQFailover — порядок перебора узлов: round-robin или priority
+	RabbitMQFailover string
+	// RabbitMQTLSCAFile — PEM с сертификатами CA для amqps://
+	RabbitMQTLSCAFile string
+	// RabbitMQTLSCertFile и RabbitMQTLSKeyFile — клиентский сертификат и ключ
+	RabbitMQTLSCertFile string
+	RabbitMQTLSKeyFile  string
+	// RabbitMQTLSServerName — имя сервера для проверки сертификата, пусто — хост из DSN
+	RabbitMQTLSServerName string
+	// RabbitMQSASLExternal включает аутентификацию по клиентскому сертификату (SASL EXTERNAL)
+	RabbitMQSASLExternal bool
+	// RabbitMQConfirm включает режим publisher confirms
+	RabbitMQConfirm bool
+	// RabbitMQConfirmTimeout ограничивает ожидание подтверждения от брокера
+	RabbitMQConfirmTimeout time.Duration
+	// RabbitMQPoolSize — количество AMQP каналов в пуле
+	RabbitMQPoolSize int
+	// RabbitMQConnections — количество соединений, между которыми распределяются каналы
+	RabbitMQConnections int
+	// RabbitMQConnectWait — сколько запрос ждет переподключения к брокеру перед ответом 503
+	RabbitMQConnectWait time.Duration
+	// RabbitMQCodec — кодек сжатия сообщений: gzip, zstd, snappy, lz4, none
+	RabbitMQCodec string
+	// RabbitMQGzipLevel — уровень сжатия gzip (-1 — уровень по умолчанию)
+	RabbitMQGzipLevel int
+	// RabbitMQCompressMinSize — сообщения меньше этого размера в байтах не сжимаются
+	RabbitMQCompressMinSize int
+	// RabbitMQSpoolDir — каталог дискового спула для неотправленных событий, пусто — спул выключен
+	RabbitMQSpoolDir string
+	// RabbitMQSpoolFsync — политика fsync спула: always, interval, never
+	RabbitMQSpoolFsync string
+	// RabbitMQSpoolFsyncInterval — период fsync для политики interval
+	RabbitMQSpoolFsyncInterval time.Duration
+	// RabbitMQSpoolMaxBytes — максимальный размер спула в байтах, 0 — без ограничения
+	RabbitMQSpoolMaxBytes int64
+	// RabbitMQSpoolSegmentBytes — размер одного сегмента спула в байтах
+	RabbitMQSpoolSegmentBytes int64
+	// RabbitMQDeadLetter включает dead-letter exchange и очереди <queue>.dlq
+	RabbitMQDeadLetter bool
+	// RabbitMQMessageTTL — x-message-ttl для очередей, 0 — без ограничения
+	RabbitMQMessageTTL time.Duration
+	// RabbitMQMaxLength — x-max-length для очередей, 0 — без ограничения
+	RabbitMQMaxLength int
+	// RabbitMQOverflow — x-overflow: drop-head, reject-publish, reject-publish-dlx (кроме quorum очередей)
+	RabbitMQOverflow string
+	// RabbitMQQueueType — тип очередей: classic, quorum, stream
+	RabbitMQQueueType string
+	// RabbitMQQueueTypes — переопределения типа для отдельных очередей ("system-go=stream,go=quorum")
+	RabbitMQQueueTypes map[string]string
+	// RabbitMQDeliveryLimit — x-delivery-limit для quorum очередей
+	RabbitMQDeliveryLimit int
+	// RabbitMQQuorumInitialGroupSize — x-quorum-initial-group-size для quorum очередей
+	RabbitMQQuorumInitialGroupSize int
+	// RabbitMQStreamMaxAge — x-max-age для stream очередей ("7D")
+	RabbitMQStreamMaxAge string
+	// RabbitMQShards — количество шардов каждой очереди по txId, 0 — без шардирования
+	RabbitMQShards int
+	// RabbitMQMaxPriority — x-max-priority для classic очередей, 0 — без приоритетов
+	RabbitMQMaxPriority int
+	// RabbitMQDefaultPriority — приоритет событий без trackData.priority
+	RabbitMQDefaultPriority int
+	// RabbitMQBreakerThreshold — сколько неудачных публикаций подряд размыкают circuit breaker, 0 — выключен
+	RabbitMQBreakerThreshold int
+	// RabbitMQBreakerCoolDown — время, на которое размыкается circuit breaker
+	RabbitMQBreakerCoolDown time.Duration
+	// RabbitMQTopologyFile — YAML/JSON файл с топологией брокера, пусто — топология по умолчанию
+	RabbitMQTopologyFile string
 }
 
 // Load читает конфигурацию из переменных окружения
 // Паникует если обязательные переменные не заданы
 func Load() *Config {
+	backend := getEnv("PUBLISHER_BACKEND", "rabbitmq")
+	// DSN нужен только бэкенду rabbitmq
+	dsn := os.Getenv("DSN__RABBITMQ")
+	if backend == "rabbitmq" {
+		dsn = getEnvRequired("DSN__RABBITMQ")
+	}
 	return &Config{
-		RabbitMQURL: getEnvRequired("DSN__RABBITMQ"),
-		SocketPath:  getEnvRequired("SOCKET_PATH"),
+		PublisherBackend:               backend,
+		MemoryFailureRate:              getEnvFloat("MEMORY_FAILURE_RATE", 0),
+		MemoryNackRate:                 getEnvFloat("MEMORY_NACK_RATE", 0),
+		MemoryLatency:                  getEnvDuration("MEMORY_LATENCY", 0),
+		MemoryCapacity:                 getEnvInt("MEMORY_CAPACITY", 10000),
+		AsyncPublish:                   getEnvBool("ASYNC_PUBLISH", false),
+		AsyncQueueSize:                 getEnvInt("ASYNC_QUEUE_SIZE", 10000),
+		AsyncWorkers:                   getEnvInt("ASYNC_WORKERS", 4),
+		AsyncBatchSize:                 getEnvInt("ASYNC_BATCH_SIZE", 100),
+		AsyncDrainTimeout:              getEnvDuration("ASYNC_DRAIN_TIMEOUT", 10*time.Second),
+		DedupTTL:                       getEnvDuration("DEDUP_TTL", 0),
+		DedupCapacity:                  getEnvInt("DEDUP_CAPACITY", 100000),
+		DedupShards:                    getEnvInt("DEDUP_SHARDS", 16),
+		IdempotencyTTL:                 getEnvDuration("IDEMPOTENCY_TTL", 0),
+		IdempotencyCapacity:            getEnvInt("IDEMPOTENCY_CAPACITY", 100000),
+		MetricsAddr:                    getEnv("METRICS_ADDR", ""),
+		RabbitMQURLs:                   splitList(dsn),
+		RabbitMQFailover:               getEnv("RABBITMQ_FAILOVER", "round-robin"),
+		RabbitMQTLSCAFile:              getEnv("RABBITMQ_TLS_CA_FILE", ""),
+		RabbitMQTLSCertFile:            getEnv("RABBITMQ_TLS_CERT_FILE", ""),
+		RabbitMQTLSKeyFile:             getEnv("RABBITMQ_TLS_KEY_FILE", ""),
+		RabbitMQTLSServerName:          getEnv("RABBITMQ_TLS_SERVER_NAME", ""),
+		RabbitMQSASLExternal:           getEnvBool("RABBITMQ_SASL_EXTERNAL", false),
+		SocketPath:                     getEnvRequired("SOCKET_PATH"),
+		RabbitMQConfirm:                getEnvBool("RABBITMQ_CONFIRM", false),
+		RabbitMQConfirmTimeout:         getEnvDuration("RABBITMQ_CONFIRM_TIMEOUT", 5*time.Second),
+		RabbitMQPoolSize:               getEnvInt("RABBITMQ_POOL_SIZE", 16),
+		RabbitMQConnections:            getEnvInt("RABBITMQ_CONNECTIONS", 1),
+		RabbitMQConnectWait:            getEnvDuration("RABBITMQ_CONNECT_WAIT", 0),
+		RabbitMQCodec:                  getEnv("RABBITMQ_CODEC", "gzip"),
+		RabbitMQGzipLevel:              getEnvInt("RABBITMQ_GZIP_LEVEL", -1),
+		RabbitMQCompressMinSize:        getEnvInt("RABBITMQ_COMPRESS_MIN_SIZE", 0),
+		RabbitMQSpoolDir:               getEnv("RABBITMQ_SPOOL_DIR", ""),
+		RabbitMQSpoolFsync:             getEnv("RABBITMQ_SPOOL_FSYNC", "always"),
+		RabbitMQSpoolFsyncInterval:     getEnvDuration("RABBITMQ_SPOOL_FSYNC_INTERVAL", time.Second),
+		RabbitMQSpoolMaxBytes:          int64(getEnvInt("RABBITMQ_SPOOL_MAX_BYTES", 0)),
+		RabbitMQSpoolSegmentBytes:      int64(getEnvInt("RABBITMQ_SPOOL_SEGMENT_BYTES", 64<<20)),
+		RabbitMQDeadLetter:             getEnvBool("RABBITMQ_DEAD_LETTER", false),
+		RabbitMQMessageTTL:             getEnvDuration("RABBITMQ_MESSAGE_TTL", 0),
+		RabbitMQMaxLength:              getEnvInt("RABBITMQ_MAX_LENGTH", 0),
+		RabbitMQOverflow:               getEnv("RABBITMQ_OVERFLOW", ""),
+		RabbitMQQueueType:              getEnv("RABBITMQ_QUEUE_TYPE", "classic"),
+		RabbitMQQueueTypes:             getEnvMap("RABBITMQ_QUEUE_TYPES"),
+		RabbitMQDeliveryLimit:          getEnvInt("RABBITMQ_DELIVERY_LIMIT", 0),
+		RabbitMQQuorumInitialGroupSize: getEnvInt("RABBITMQ_QUORUM_INITIAL_GROUP_SIZE", 0),
+		RabbitMQStreamMaxAge:           getEnv("RABBITMQ_STREAM_MAX_AGE", ""),
+		RabbitMQShards:                 getEnvInt("RABBITMQ_SHARDS", 0),
+		RabbitMQMaxPriority:            getEnvInt("RABBITMQ_MAX_PRIORITY", 0),
+		RabbitMQDefaultPriority:        getEnvInt("RABBITMQ_DEFAULT_PRIORITY", 0),
+		RabbitMQBreakerThreshold:       getEnvInt("RABBITMQ_BREAKER_THRESHOLD", 0),
+		RabbitMQBreakerCoolDown:        getEnvDuration("RABBITMQ_BREAKER_COOLDOWN", 5*time.Second),
+		RabbitMQTopologyFile:           getEnv("RABBITMQ_TOPOLOGY_FILE", ""),
 	}
 }
 
@@ -29,3 +187,97 @@ func getEnvRequired(key string) string {
 	}
 	return value
 }
+
+// splitList разбивает список через запятую, пропуская пустые элементы
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnv читает необязательную переменную окружения
+func getEnv(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// getEnvBool читает необязательную булеву переменную окружения
+// Паникует если значение не удается разобрать
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		panic(fmt.Sprintf("environment variable %s must be a boolean, got %q", key, value))
+	}
+	return parsed
+}
+
+// getEnvInt читает необязательную целочисленную переменную окружения
+// Паникует если значение не удается разобрать
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Sprintf("environment variable %s must be an integer, got %q", key, value))
+	}
+	return parsed
+}
+
+// getEnvFloat читает необязательную дробную переменную окружения
+// Паникует если значение не удается разобрать
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		panic(fmt.Sprintf("environment variable %s must be a number, got %q", key, value))
+	}
+	return parsed
+}
+
+// getEnvMap читает необязательную переменную окружения вида "key1=value1,key2=value2"
+// Паникует если пара не содержит '='
+func getEnvMap(key string) map[string]string {
+	value := os.Getenv(key)
+	result := map[string]string{}
+	if value == "" {
+		return result
+	}
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			panic(fmt.Sprintf("environment variable %s must be a list of key=value pairs, got %q", key, value))
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// getEnvDuration читает необязательную переменную окружения с длительностью (например "5s")
+// Паникует если значение не удается разобрать
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("environment variable %s must be a duration, got %q", key, value))
+	}
+	return parsed
+}
@@ -3,12 +3,14 @@ module github.com/ex10se/http-perf-test/go_fasthttp
 go 1.25
 
 require (
+	github.com/klauspost/compress v1.18.2
+	github.com/pierrec/lz4/v4 v4.1.31
 	github.com/rabbitmq/amqp091-go v1.10.0
 	github.com/valyala/fasthttp v1.68.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/andybalholm/brotli v1.2.0 // indirect
-	github.com/klauspost/compress v1.18.2 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 )
@@ -0,0 +1,117 @@
+package idempotency
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Header — заголовок, в котором клиент передает ключ идемпотентности запроса
+const Header = "Idempotency-Key"
+
+// ReplayedHeader отмечает ответ, который повторен из хранилища, а не обработан заново
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength ограничивает длину ключа, чтобы хранилище не раздували произвольно длинные заголовки
+const MaxKeyLength = 255
+
+// ErrInFlight — запрос с тем же ключом еще обрабатывается
+var ErrInFlight = errors.New("a request with this Idempotency-Key is still in progress")
+
+// Response — сохраненный ответ на запрос
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// record — состояние ключа: запрос в обработке (response == nil) или его итоговый ответ
+type record struct {
+	key      string
+	response *Response
+	expires  time.Time
+}
+
+// Store хранит ответы на запросы с Idempotency-Key в течение TTL, чтобы повтор запроса
+// получил тот же ответ, а не обработался второй раз.
+// Ключи лежат в списке в порядке истечения, поэтому устаревшие и лишние
+// сверх емкости удаляются с начала списка
+type Store struct {
+	ttl      time.Duration
+	capacity int
+	mu       sync.Mutex
+	records  map[string]*list.Element
+	order    *list.List
+}
+
+// NewStore создает хранилище, которое помнит ответ ttl и хранит не больше capacity ключей
+func NewStore(ttl time.Duration, capacity int) *Store {
+	return &Store{
+		ttl:      ttl,
+		capacity: max(capacity, 1),
+		records:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Begin начинает обработку запроса с ключом key.
+// Возвращает сохраненный ответ, если запрос уже обработан, и ErrInFlight, если он еще обрабатывается.
+// (nil, nil) — запрос новый, по его завершении нужно вызвать Finish.
+// Ключ в обработке тоже живет не дольше TTL, чтобы он не остался занятым навсегда, если Finish не вызван
+func (s *Store) Begin(key string) (*Response, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(now)
+	if element, ok := s.records[key]; ok {
+		if record := element.Value.(*record); now.Before(record.expires) {
+			if record.response == nil {
+				return nil, ErrInFlight
+			}
+			return record.response, nil
+		}
+		s.remove(element)
+	}
+	s.records[key] = s.order.PushBack(&record{key: key, expires: now.Add(s.ttl)})
+	return nil, nil
+}
+
+// Finish сохраняет итоговый ответ на запрос с ключом key.
+// 5xx и 429 говорят о временной проблеме, поэтому такие ответы не сохраняются
+// и повтор запроса обрабатывается заново
+func (s *Store) Finish(key string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.records[key]
+	if !ok {
+		return
+	}
+	if response.Status >= http.StatusInternalServerError || response.Status == http.StatusTooManyRequests {
+		s.remove(element)
+		return
+	}
+	// Копируем тело: буфер ответа фреймворк может переиспользовать
+	response.Body = append([]byte(nil), response.Body...)
+	record := element.Value.(*record)
+	record.response = &response
+	record.expires = time.Now().Add(s.ttl)
+	s.order.MoveToBack(element)
+}
+
+// evict удаляет истекшие ключи и самые старые сверх емкости. Вызывается под s.mu
+func (s *Store) evict(now time.Time) {
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		if s.order.Len() < s.capacity && now.Before(front.Value.(*record).expires) {
+			return
+		}
+		s.remove(front)
+	}
+}
+
+// remove удаляет ключ из хранилища. Вызывается под s.mu
+func (s *Store) remove(element *list.Element) {
+	delete(s.records, element.Value.(*record).key)
+	s.order.Remove(element)
+}
@@ -0,0 +1,61 @@
+package publisher
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ex10se/http-perf-test/go_fasthttp/rabbitmq"
+)
+
+// TestAsyncDone проверяет, что воркер сообщает колбэку результат публикации каждого события
+func TestAsyncDone(t *testing.T) {
+	memory := NewMemory(MemoryOptions{})
+	memory.NackNext(1)
+	async := NewAsync(memory, AsyncOptions{QueueSize: 10, Workers: 2, BatchSize: 2})
+	messages := []rabbitmq.Message{
+		{RoutingKey: rabbitmq.QueueGolang, Body: []byte(`{"txId":"1"}`)},
+		{RoutingKey: rabbitmq.QueueGolang, Body: []byte(`{"txId":"2"}`)},
+		{RoutingKey: rabbitmq.QueueGolang, Body: []byte(`{"txId":"3"}`)},
+	}
+	var mu sync.Mutex
+	results := map[int]error{}
+	err := async.Enqueue(messages, func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close дожидается публикации всей очереди
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(messages) {
+		t.Fatalf("done called for %d of %d events", len(results), len(messages))
+	}
+	nacked := 0
+	for _, err := range results {
+		if errors.Is(err, rabbitmq.ErrNacked) {
+			nacked++
+		}
+	}
+	if nacked != 1 || memory.Count(rabbitmq.QueueGolang) != 2 {
+		t.Errorf("%d nacked, %d published; want 1 and 2", nacked, memory.Count(rabbitmq.QueueGolang))
+	}
+}
+
+func TestAsyncEnqueueRejected(t *testing.T) {
+	async := NewAsync(NewMemory(MemoryOptions{}), AsyncOptions{QueueSize: 1})
+	messages := []rabbitmq.Message{{RoutingKey: rabbitmq.QueueGolang}, {RoutingKey: rabbitmq.QueueGolang}}
+	if err := async.Enqueue(messages, nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Enqueue() error = %v, want ErrQueueFull", err)
+	}
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.Enqueue(messages[:1], nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Enqueue() after Close error = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,65 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ex10se/http-perf-test/go_fasthttp/rabbitmq"
+)
+
+// TestMemoryDestinations проверяет, что сообщения сохраняются в очереди, куда их доставил бы брокер
+func TestMemoryDestinations(t *testing.T) {
+	topology := &rabbitmq.Topology{
+		Exchange: "events",
+		Exchanges: []rabbitmq.ExchangeSpec{
+			{Name: "events", Type: "topic"},
+			{Name: "audit", Type: "fanout"},
+			{Name: "custom", Type: "headers"},
+		},
+		Queues: []rabbitmq.QueueSpec{{Name: "all"}, {Name: "errors"}, {Name: "audit-1"}, {Name: "audit-2"}},
+		Bindings: []rabbitmq.BindingSpec{
+			{Queue: "all", Exchange: "events", RoutingKey: "event.#"},
+			{Queue: "errors", Exchange: "events", RoutingKey: "event.error"},
+			{Queue: "audit-1", Exchange: "audit"},
+			{Queue: "audit-2", Exchange: "audit"},
+		},
+	}
+	memory := NewMemory(MemoryOptions{Topology: topology})
+	messages := []rabbitmq.Message{
+		{RoutingKey: "event.success"},
+		{RoutingKey: "event.error"},
+		{Exchange: "audit", RoutingKey: "anything"},
+		// Не доходит ни до одной очереди и отбрасывается
+		{RoutingKey: "unrouted"},
+		// Маршрутизацию headers exchange не вычислить — очередью считается ключ
+		{Exchange: "custom", RoutingKey: "custom-key"},
+	}
+	for i, err := range memory.PublishBatch(context.Background(), messages) {
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	want := map[string]int{"all": 2, "errors": 1, "audit-1": 1, "audit-2": 1, "unrouted": 0, "event.success": 0, "custom-key": 1}
+	for queue, count := range want {
+		if got := memory.Count(queue); got != count {
+			t.Errorf("Count(%q) = %d, want %d", queue, got, count)
+		}
+	}
+}
+
+func TestMemoryDefaultTopology(t *testing.T) {
+	memory := NewMemory(MemoryOptions{Capacity: 2})
+	for i := 0; i < 3; i++ {
+		if err := memory.Publish(context.Background(), rabbitmq.QueueGolang, []byte{byte('0' + i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Capacity хранит последние сообщения очереди
+	messages := memory.Messages(rabbitmq.QueueGolang)
+	if len(messages) != 2 || string(messages[0].Body) != "1" || string(messages[1].Body) != "2" {
+		t.Errorf("Messages() = %v, want the last 2", messages)
+	}
+	if err := memory.Publish(context.Background(), "unknown", nil); err != nil || memory.Count("unknown") != 0 {
+		t.Errorf("unroutable message: error %v, stored %d", err, memory.Count("unknown"))
+	}
+}
@@ -0,0 +1,81 @@
+package publisher
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ex10se/http-perf-test/go_fasthttp/config"
+	"github.com/ex10se/http-perf-test/go_fasthttp/rabbitmq"
+)
+
+// RabbitMQ клиент реализует Publisher
+var _ Publisher = (*rabbitmq.Client)(nil)
+
+// newRabbitMQ создает RabbitMQ клиент из конфигурации и декларирует топологию
+func newRabbitMQ(cfg *config.Config, topology *rabbitmq.Topology) (*rabbitmq.Client, error) {
+	log.Printf("RabbitMQ nodes: %v (failover: %s)", rabbitmq.NodeNames(cfg.RabbitMQURLs), cfg.RabbitMQFailover)
+	// Выбираем кодек сжатия сообщений
+	codec, err := rabbitmq.NewCodec(cfg.RabbitMQCodec, cfg.RabbitMQGzipLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RabbitMQ codec: %w", err)
+	}
+	client, err := rabbitmq.New(rabbitmq.Options{
+		URLs:     cfg.RabbitMQURLs,
+		Failover: cfg.RabbitMQFailover,
+		TLS: rabbitmq.TLSOptions{
+			CAFile:     cfg.RabbitMQTLSCAFile,
+			CertFile:   cfg.RabbitMQTLSCertFile,
+			KeyFile:    cfg.RabbitMQTLSKeyFile,
+			ServerName: cfg.RabbitMQTLSServerName,
+			External:   cfg.RabbitMQSASLExternal,
+		},
+		Confirm:         cfg.RabbitMQConfirm,
+		ConfirmTimeout:  cfg.RabbitMQConfirmTimeout,
+		PoolSize:        cfg.RabbitMQPoolSize,
+		Connections:     cfg.RabbitMQConnections,
+		ConnectWait:     cfg.RabbitMQConnectWait,
+		Codec:           codec,
+		CompressMinSize: cfg.RabbitMQCompressMinSize,
+		Spool: rabbitmq.SpoolOptions{
+			Dir:           cfg.RabbitMQSpoolDir,
+			Fsync:         cfg.RabbitMQSpoolFsync,
+			FsyncInterval: cfg.RabbitMQSpoolFsyncInterval,
+			MaxBytes:      cfg.RabbitMQSpoolMaxBytes,
+			SegmentBytes:  cfg.RabbitMQSpoolSegmentBytes,
+		},
+		Queues:          queueOptions(cfg),
+		Topology:        topology,
+		DefaultPriority: cfg.RabbitMQDefaultPriority,
+		Breaker: rabbitmq.BreakerOptions{
+			FailureThreshold: cfg.RabbitMQBreakerThreshold,
+			CoolDown:         cfg.RabbitMQBreakerCoolDown,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RabbitMQ client: %w", err)
+	}
+	// Декларируем очереди
+	log.Println("Declaring RabbitMQ queues...")
+	if err := client.DeclareQueues(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to declare queues: %w", err)
+	}
+	return client, nil
+}
+
+// queueOptions возвращает аргументы очередей топологии по умолчанию из конфигурации
+func queueOptions(cfg *config.Config) rabbitmq.QueueOptions {
+	return rabbitmq.QueueOptions{
+		DeadLetter:       cfg.RabbitMQDeadLetter,
+		MessageTTL:       cfg.RabbitMQMessageTTL,
+		MaxLength:        cfg.RabbitMQMaxLength,
+		Overflow:         cfg.RabbitMQOverflow,
+		Type:             cfg.RabbitMQQueueType,
+		Types:            cfg.RabbitMQQueueTypes,
+		DeliveryLimit:    cfg.RabbitMQDeliveryLimit,
+		InitialGroupSize: cfg.RabbitMQQuorumInitialGroupSize,
+		MaxAge:           cfg.RabbitMQStreamMaxAge,
+		Shards:           cfg.RabbitMQShards,
+		MaxPriority:      cfg.RabbitMQMaxPriority,
+	}
+}
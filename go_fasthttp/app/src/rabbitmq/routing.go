@@ -0,0 +1,159 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ex10se/http-perf-test/go_fasthttp/models"
+)
+
+// Route — куда публикуется событие
+type Route struct {
+	// Exchange — exchange для публикации, пусто — exchange топологии
+	Exchange   string `yaml:"exchange" json:"exchange"`
+	RoutingKey string `yaml:"routing_key" json:"routing_key"`
+	// Shards — количество шардов: к ключу добавляется номер шарда по txId ("go.3").
+	// 0 или 1 — без шардирования
+	Shards int `yaml:"shards" json:"shards"`
+}
+
+// key возвращает ключ маршрутизации события с учетом шардирования
+func (r Route) key(event *models.StatusEvent) string {
+	if r.Shards <= 1 {
+		return r.RoutingKey
+	}
+	return ShardQueueName(r.RoutingKey, shardOf(event.TxID, r.Shards))
+}
+
+// keys возвращает все ключи маршрутизации, которые может дать маршрут
+func (r Route) keys() []string {
+	if r.Shards <= 1 {
+		return []string{r.RoutingKey}
+	}
+	keys := make([]string, r.Shards)
+	for shard := range keys {
+		keys[shard] = ShardQueueName(r.RoutingKey, shard)
+	}
+	return keys
+}
+
+// Match — условия правила маршрутизации. Пустое условие выполняется всегда,
+// для списков достаточно совпадения с любым значением
+type Match struct {
+	State     []string `yaml:"state" json:"state"`
+	Channel   []string `yaml:"channel" json:"channel"`
+	ChannelID []string `yaml:"channel_id" json:"channel_id"`
+	// HasError — наличие поля error в событии
+	HasError *bool `yaml:"has_error" json:"has_error"`
+	IsSystem *bool `yaml:"is_system" json:"is_system"`
+	// MinPriority и MaxPriority ограничивают trackData.priority включительно,
+	// события без приоритета под такое правило не подходят
+	MinPriority *int `yaml:"min_priority" json:"min_priority"`
+	MaxPriority *int `yaml:"max_priority" json:"max_priority"`
+}
+
+// Rule — правило маршрутизации: событие, подходящее под все условия Match, уходит в Route
+type Rule struct {
+	Match Match `yaml:"match" json:"match"`
+	Route `yaml:",inline"`
+}
+
+// Router выбирает маршрут события по первому подходящему правилу.
+// Описывается в секции routing файла топологии:
+//
+//	routing:
+//	  rules:
+//	    - match: {has_error: true}
+//	      routing_key: errors
+//	    - match: {channel: [email]}
+//	      routing_key: email
+//	  default:
+//	    routing_key: go
+type Router struct {
+	Rules   []Rule `yaml:"rules" json:"rules"`
+	Default *Route `yaml:"default" json:"default"`
+}
+
+// DefaultRouter повторяет маршрутизацию по умолчанию:
+// системные события в QueueSystemGolang, остальные в QueueGolang.
+// shards > 1 распределяет события по шардам DefaultTopology
+func DefaultRouter(shards int) *Router {
+	isSystem := true
+	return &Router{
+		Rules: []Rule{
+			{Match: Match{IsSystem: &isSystem}, Route: Route{RoutingKey: QueueSystemGolang, Shards: shards}},
+		},
+		Default: &Route{RoutingKey: QueueGolang, Shards: shards},
+	}
+}
+
+// Route возвращает маршрут первого подходящего правила или маршрут по умолчанию
+func (r *Router) Route(event *models.StatusEvent) Route {
+	for _, rule := range r.Rules {
+		if rule.Match.matches(event) {
+			return rule.Route
+		}
+	}
+	return *r.Default
+}
+
+// validate проверяет что маршрут по умолчанию задан
+// и что правила публикуют только в объявленные exchanges
+func (r *Router) validate(declared func(string) bool) error {
+	if r.Default == nil {
+		return fmt.Errorf("routing: default route is required")
+	}
+	for _, route := range r.routes() {
+		if route.Exchange != "" && !declared(route.Exchange) {
+			return fmt.Errorf("routing: route references undeclared exchange %q", route.Exchange)
+		}
+		if route.Shards < 0 {
+			return fmt.Errorf("routing: route %q has negative shards", route.RoutingKey)
+		}
+	}
+	return nil
+}
+
+// routes возвращает маршруты всех правил и маршрут по умолчанию
+func (r *Router) routes() []Route {
+	routes := make([]Route, 0, len(r.Rules)+1)
+	for _, rule := range r.Rules {
+		routes = append(routes, rule.Route)
+	}
+	if r.Default != nil {
+		routes = append(routes, *r.Default)
+	}
+	return routes
+}
+
+// matches проверяет все заданные условия
+func (m *Match) matches(event *models.StatusEvent) bool {
+	if len(m.State) > 0 && !slices.Contains(m.State, event.State) {
+		return false
+	}
+	if len(m.Channel) > 0 && (event.Channel == nil || !slices.Contains(m.Channel, *event.Channel)) {
+		return false
+	}
+	if len(m.ChannelID) > 0 && (event.ChannelID == nil || !slices.Contains(m.ChannelID, *event.ChannelID)) {
+		return false
+	}
+	if m.HasError != nil && *m.HasError != (event.Error != nil) {
+		return false
+	}
+	if m.IsSystem != nil && *m.IsSystem != event.IsSystemEvent() {
+		return false
+	}
+	if m.MinPriority != nil || m.MaxPriority != nil {
+		if event.TrackData == nil || event.TrackData.Priority == nil {
+			return false
+		}
+		priority := *event.TrackData.Priority
+		if m.MinPriority != nil && priority < *m.MinPriority {
+			return false
+		}
+		if m.MaxPriority != nil && priority > *m.MaxPriority {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package dedup
+
+import (
+	"container/list"
+	"errors"
+	"expvar"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Метрики кэша публикуются через expvar (/debug/vars) в карте dedup
+var (
+	entries    = new(expvar.Int)
+	duplicates = new(expvar.Int)
+	evictions  = new(expvar.Int)
+)
+
+func init() {
+	metrics := expvar.NewMap("dedup")
+	metrics.Set("entries", entries)
+	metrics.Set("duplicates", duplicates)
+	metrics.Set("evictions", evictions)
+}
+
+// DefaultShards — количество шардов кэша по умолчанию
+const DefaultShards = 16
+
+// ErrInFlight — то же событие сейчас публикует другой запрос
+var ErrInFlight = errors.New("event is being published by another request")
+
+// Cache запоминает недавно принятые события, чтобы не публиковать повторы,
+// которые присылает upstream при ретраях.
+// Это LRU кэш ключей с TTL, разбитый на шарды со своими блокировками,
+// чтобы параллельные запросы не упирались в один мьютекс
+type Cache struct {
+	ttl    time.Duration
+	shards []*shard
+	// tokens выдает номера резервациям Begin
+	tokens atomic.Uint64
+}
+
+// shard — часть кэша: ключи в порядке последнего обращения, в начале списка самые свежие
+type shard struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+// entry — элемент списка shard.order.
+// pending — событие еще публикуется: ключ занят, но повтор нельзя считать принятым.
+// token — номер резервации, которая заняла ключ
+type entry struct {
+	key     string
+	expires time.Time
+	pending bool
+	token   uint64
+}
+
+// Reservation — ключ, занятый Begin. Занятый ключ может истечь или быть вытеснен
+// и достаться другому запросу, поэтому Finish по токену проверяет, что ключ все еще наш
+type Reservation struct {
+	Key   string
+	token uint64
+}
+
+// New создает кэш, который помнит ключ ttl с момента добавления
+// и хранит не больше capacity ключей, вытесняя давно не встречавшиеся
+func New(ttl time.Duration, capacity, shards int) *Cache {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	// Каждому шарду достается равная доля емкости, но не меньше одного ключа
+	perShard := max(1, capacity/shards)
+	c := &Cache{ttl: ttl, shards: make([]*shard, shards)}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			capacity: perShard,
+			items:    map[string]*list.Element{},
+			order:    list.New(),
+		}
+	}
+	return c
+}
+
+// Begin занимает ключ на время публикации события.
+// true означает повтор в пределах TTL: событие уже опубликовано и публиковать его не нужно.
+// ErrInFlight — событие публикует другой запрос, повтор нельзя ни публиковать, ни подтверждать.
+// После Begin без ошибки и повтора вызывающий обязан вызвать Finish с полученной резервацией
+func (c *Cache) Begin(key string) (Reservation, bool, error) {
+	s := c.shard(key)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.items[key]; ok {
+		e := element.Value.(*entry)
+		if now.Before(e.expires) {
+			if e.pending {
+				return Reservation{}, false, ErrInFlight
+			}
+			s.order.MoveToFront(element)
+			duplicates.Add(1)
+			return Reservation{}, true, nil
+		}
+		s.remove(element)
+	}
+	reservation := Reservation{Key: key, token: c.tokens.Add(1)}
+	s.items[key] = s.order.PushFront(&entry{key: key, expires: now.Add(c.ttl), pending: true, token: reservation.token})
+	entries.Add(1)
+	s.evict(now)
+	return reservation, false, nil
+}
+
+// Finish завершает публикацию, начатую Begin.
+// Опубликованное событие кэш помнит TTL, неопубликованное забывает,
+// чтобы повтор запроса его опубликовал. Ключ, который после истечения
+// или вытеснения занял другой запрос, Finish не трогает
+func (c *Cache) Finish(r Reservation, published bool) {
+	s := c.shard(r.Key)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.items[r.Key]
+	owned := ok && element.Value.(*entry).token == r.token
+	if !published {
+		if owned && element.Value.(*entry).pending {
+			s.remove(element)
+		}
+		return
+	}
+	if ok && !owned {
+		return
+	}
+	// Ключ мог быть вытеснен, пока событие публиковалось — запоминаем заново
+	if !ok {
+		element = s.order.PushFront(&entry{key: r.Key, token: r.token})
+		s.items[r.Key] = element
+		entries.Add(1)
+	}
+	e := element.Value.(*entry)
+	e.expires = now.Add(c.ttl)
+	e.pending = false
+	s.order.MoveToFront(element)
+	s.evict(now)
+}
+
+// shard выбирает шард по FNV-1a хэшу ключа
+func (c *Cache) shard(key string) *shard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return c.shards[hash.Sum32()%uint32(len(c.shards))]
+}
+
+// evict удаляет устаревшие ключи с конца списка и вытесняет самые старые сверх емкости.
+// Вызывается под s.mu
+func (s *shard) evict(now time.Time) {
+	for back := s.order.Back(); back != nil; back = s.order.Back() {
+		if s.order.Len() > s.capacity {
+			evictions.Add(1)
+		} else if now.Before(back.Value.(*entry).expires) {
+			return
+		}
+		s.remove(back)
+	}
+}
+
+// remove удаляет элемент из шарда. Вызывается под s.mu
+func (s *shard) remove(element *list.Element) {
+	delete(s.items, element.Value.(*entry).key)
+	s.order.Remove(element)
+	entries.Add(-1)
+}
@@ -4,7 +4,10 @@ go 1.25
 
 require (
 	github.com/gin-gonic/gin v1.11.0
+	github.com/klauspost/compress v1.18.2
+	github.com/pierrec/lz4/v4 v4.1.31
 	github.com/rabbitmq/amqp091-go v1.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,27 +1,64 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
+	"github.com/ex10se/http-perf-test/go_gin/dedup"
+	"github.com/ex10se/http-perf-test/go_gin/idempotency"
 	"github.com/ex10se/http-perf-test/go_gin/models"
+	"github.com/ex10se/http-perf-test/go_gin/publisher"
 	"github.com/ex10se/http-perf-test/go_gin/rabbitmq"
 	"github.com/gin-gonic/gin"
 )
 
 // StatusHandler обрабатывает запросы к /status/status/
 type StatusHandler struct {
-	rmqClient *rabbitmq.Client
+	publisher publisher.Publisher
+	// async — очередь асинхронной публикации, nil если хэндлер ждет публикации
+	async  *publisher.Async
+	router *rabbitmq.Router
+	// dedup — недавно принятые события, nil если дедупликация выключена
+	dedup *dedup.Cache
+	// idempotency — ответы на запросы с Idempotency-Key, nil если заголовок игнорируется
+	idempotency *idempotency.Store
 }
 
-// NewStatusHandler создает новый хэндлер
-func NewStatusHandler(rmqClient *rabbitmq.Client) *StatusHandler {
+// NewStatusHandler создает новый хэндлер.
+// Если pub — publisher.Async, хэндлер отвечает 202 сразу после постановки событий в очередь.
+// cache — кэш дедупликации повторных событий, nil — публиковать каждое событие.
+// store — хранилище ответов для Idempotency-Key, nil — заголовок игнорируется
+func NewStatusHandler(pub publisher.Publisher, router *rabbitmq.Router, cache *dedup.Cache, store *idempotency.Store) *StatusHandler {
+	async, _ := pub.(*publisher.Async)
 	return &StatusHandler{
-		rmqClient: rmqClient,
+		publisher:   pub,
+		async:       async,
+		router:      router,
+		dedup:       cache,
+		idempotency: store,
 	}
 }
 
+// responseRecorder передает тело ответа клиенту и сохраняет его копию для Idempotency-Key
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
 // errorResponse отправляет JSON ответ с ошибкой
 func errorResponse(ctx *gin.Context, message string, statusCode int) {
 	ctx.Header("Content-Type", "application/json")
@@ -33,58 +70,146 @@ func errorResponse(ctx *gin.Context, message string, statusCode int) {
 	}
 }
 
-// successResponse отправляет JSON ответ с успехом
-func successResponse(ctx *gin.Context, processed int) {
-	ctx.Header("Content-Type", "application/json")
-	ctx.Status(http.StatusOK)
-	if err := json.NewEncoder(ctx.Writer).Encode(map[string]interface{}{
+// successResponse отправляет JSON ответ с успехом.
+// duplicates — сколько из обработанных событий оказались повторами и не публиковались
+func successResponse(ctx *gin.Context, processed, duplicates int) {
+	response := map[string]interface{}{
 		"status":    "SUCCESS",
 		"processed": processed,
-	}); err != nil {
+	}
+	if duplicates > 0 {
+		response["duplicates"] = duplicates
+	}
+	ctx.Header("Content-Type", "application/json")
+	ctx.Status(http.StatusOK)
+	if err := json.NewEncoder(ctx.Writer).Encode(response); err != nil {
 		log.Printf("Failed to encode success response: %v", err)
 	}
 }
 
-// Handle обрабатывает HTTP запрос
+// acceptedResponse отправляет ответ 202: события поставлены в очередь асинхронной публикации
+// или оказались повторами уже принятых
+func acceptedResponse(ctx *gin.Context, accepted, duplicates int, errorsList []map[string]string) {
+	response := map[string]interface{}{
+		"status":   "ACCEPTED",
+		"accepted": accepted,
+	}
+	if duplicates > 0 {
+		response["duplicates"] = duplicates
+	}
+	if len(errorsList) > 0 {
+		response["errors"] = errorsList
+	}
+	ctx.Header("Content-Type", "application/json")
+	ctx.Status(http.StatusAccepted)
+	if err := json.NewEncoder(ctx.Writer).Encode(response); err != nil {
+		log.Printf("Failed to encode accepted response: %v", err)
+	}
+}
+
+// Handle обрабатывает HTTP запрос.
+// Запрос с заголовком Idempotency-Key обрабатывается один раз: повтор получает сохраненный ответ.
+// Невалидный запрос отклоняется до того, как займет ключ
 func (h *StatusHandler) Handle(ctx *gin.Context) {
+	events, ok := h.parse(ctx)
+	if !ok {
+		return
+	}
+	key := ctx.GetHeader(idempotency.Header)
+	if h.idempotency == nil || key == "" {
+		h.publish(ctx, events)
+		return
+	}
+	if len(key) > idempotency.MaxKeyLength {
+		errorResponse(ctx, fmt.Sprintf("%s must be at most %d characters", idempotency.Header, idempotency.MaxKeyLength), http.StatusBadRequest)
+		return
+	}
+	replay, err := h.idempotency.Begin(key)
+	if err != nil {
+		errorResponse(ctx, err.Error(), http.StatusConflict)
+		return
+	}
+	if replay != nil {
+		ctx.Header("Content-Type", replay.ContentType)
+		ctx.Header(idempotency.ReplayedHeader, "true")
+		ctx.Status(replay.Status)
+		if _, err := ctx.Writer.Write(replay.Body); err != nil {
+			log.Printf("Failed to write replayed response: %v", err)
+		}
+		return
+	}
+	// Если обработка запаникует, Finish получит 500 и освободит ключ для повтора
+	response := idempotency.Response{Status: http.StatusInternalServerError}
+	defer func() {
+		h.idempotency.Finish(key, response)
+	}()
+	// Подменяем writer ответа, чтобы сохранить копию тела
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+	defer func() {
+		ctx.Writer = recorder.ResponseWriter
+	}()
+	h.publish(ctx, events)
+	response = idempotency.Response{
+		Status:      ctx.Writer.Status(),
+		ContentType: ctx.Writer.Header().Get("Content-Type"),
+		Body:        recorder.body.Bytes(),
+	}
+}
+
+// parse проверяет метод и разбирает тело запроса к /status/status/.
+// На невалидный запрос отвечает ошибкой и возвращает false
+func (h *StatusHandler) parse(ctx *gin.Context) ([]models.StatusEvent, bool) {
 	// Проверяем метод запроса
 	if ctx.Request.Method != http.MethodPost {
 		errorResponse(ctx, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, false
 	}
 	// Читаем тело запроса
 	body, err := ctx.GetRawData()
 	if err != nil || len(body) == 0 {
 		errorResponse(ctx, "Request body is required", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	// Парсим JSON массив событий
 	var events []models.StatusEvent
 	if err := json.Unmarshal(body, &events); err != nil {
 		log.Printf("Failed to parse JSON: %v", err)
 		errorResponse(ctx, "Request body must be a JSON array", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	// Проверяем что массив не пустой
 	if len(events) == 0 {
 		errorResponse(ctx, "Request body must contain at least one event", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	// Валидируем каждое событие
 	for i, event := range events {
 		if err := event.Validate(); err != nil {
 			log.Printf("Validation failed for event %d: %v", i, err)
 			errorResponse(ctx, "Validation failed: "+err.Error(), http.StatusBadRequest)
-			return
+			return nil, false
 		}
 	}
-	// Обрабатываем каждое событие
+	return events, true
+}
+
+// publish сериализует проверенные события и публикует их
+func (h *StatusHandler) publish(ctx *gin.Context, events []models.StatusEvent) {
+	// Сериализуем события и определяем очередь на основе is_system
 	var errorsList []map[string]string
+	messages := make([]rabbitmq.Message, 0, len(events))
+	txIDs := make([]string, 0, len(events))
+	// reservations — занятые ключи дедупликации публикуемых событий в том же порядке, что и messages
+	var reservations []dedup.Reservation
+	// batchKeys — ключи событий этого запроса: повтор внутри запроса не должен ждать сам себя
+	var batchKeys map[string]struct{}
+	if h.dedup != nil {
+		batchKeys = make(map[string]struct{}, len(events))
+	}
+	duplicates := 0
 	for _, event := range events {
-		// Определяем очередь на основе is_system
-		queueName := rabbitmq.GetQueueName(event.IsSystemEvent())
-		// Сериализуем событие в JSON
-		eventJSON, err := json.Marshal(event)
+		message, err := rabbitmq.NewMessage(&event, h.router)
 		if err != nil {
 			log.Printf("Failed to marshal event: %v", err)
 			errorsList = append(errorsList, map[string]string{
@@ -93,29 +218,123 @@ func (h *StatusHandler) Handle(ctx *gin.Context) {
 			})
 			continue
 		}
-		// Отправляем в RabbitMQ
-		if err := h.rmqClient.Publish(queueName, eventJSON); err != nil {
-			log.Printf("Failed to publish event %s: %v", event.TxID, err)
-			errorsList = append(errorsList, map[string]string{
-				"event": event.TxID,
-				"error": err.Error(),
-			})
+		// Повтор уже опубликованного события подтверждаем, но не публикуем
+		if h.dedup != nil {
+			key := event.DedupKey()
+			if _, ok := batchKeys[key]; ok {
+				duplicates++
+				continue
+			}
+			batchKeys[key] = struct{}{}
+			reservation, duplicate, err := h.dedup.Begin(key)
+			if err != nil {
+				// Событие публикует параллельный запрос: не подтверждаем его,
+				// иначе оно потеряется, если та публикация не удастся
+				errorsList = append(errorsList, map[string]string{
+					"event": event.TxID,
+					"error": err.Error(),
+				})
+				continue
+			}
+			if duplicate {
+				duplicates++
+				continue
+			}
+			reservations = append(reservations, reservation)
+		}
+		messages = append(messages, message)
+		txIDs = append(txIDs, event.TxID)
+	}
+	// В асинхронном режиме ставим события в очередь и отвечаем, не дожидаясь брокера
+	if h.async != nil {
+		// Ключи дедупликации воркер запомнит или забудет по результату публикации
+		var done func(int, error)
+		if h.dedup != nil {
+			done = func(i int, err error) {
+				h.dedup.Finish(reservations[i], err == nil)
+			}
+		}
+		if err := h.async.Enqueue(messages, done); err != nil {
+			log.Printf("Failed to enqueue %d events: %v", len(messages), err)
+			h.finish(reservations, nil)
+			// Очередь заполнена — 429, клиент повторит позже; сервис останавливается — 503
+			if errors.Is(err, publisher.ErrQueueFull) {
+				ctx.Header("Retry-After", "1")
+				errorResponse(ctx, err.Error(), http.StatusTooManyRequests)
+			} else {
+				errorResponse(ctx, err.Error(), http.StatusServiceUnavailable)
+			}
+			return
+		}
+		acceptedResponse(ctx, len(messages)+duplicates, duplicates, errorsList)
+		return
+	}
+	// Отправляем все события запроса в RabbitMQ одним батчем
+	results := h.publisher.PublishBatch(ctx.Request.Context(), messages)
+	// Опубликованные события запоминаем, неопубликованные забываем, чтобы повтор запроса их опубликовал
+	h.finish(reservations, results)
+	for i, err := range results {
+		if err == nil {
 			continue
 		}
+		log.Printf("Failed to publish event %s: %v", txIDs[i], err)
+		// Брокер недоступен, заблокировал публикацию или breaker разомкнут — отвечаем 503,
+		// клиент повторит запрос целиком
+		if errors.Is(err, rabbitmq.ErrUnavailable) || errors.Is(err, rabbitmq.ErrBlocked) || errors.Is(err, rabbitmq.ErrCircuitOpen) {
+			if retryAfter := rabbitmq.RetryAfterHeader(err); retryAfter != "" {
+				ctx.Header("Retry-After", retryAfter)
+			}
+			errorResponse(ctx, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		errorsList = append(errorsList, map[string]string{
+			"event": txIDs[i],
+			"error": err.Error(),
+		})
 	}
 	// Если были ошибки - возвращаем частичный успех
 	if len(errorsList) > 0 {
 		ctx.Header("Content-Type", "application/json")
 		ctx.Status(http.StatusBadRequest)
-		if err := json.NewEncoder(ctx.Writer).Encode(map[string]interface{}{
+		response := map[string]interface{}{
 			"status":    "PARTIAL_SUCCESS",
 			"processed": len(events) - len(errorsList),
 			"errors":    errorsList,
-		}); err != nil {
+		}
+		if duplicates > 0 {
+			response["duplicates"] = duplicates
+		}
+		if err := json.NewEncoder(ctx.Writer).Encode(response); err != nil {
 			log.Printf("Failed to encode partial success response: %v", err)
 		}
 		return
 	}
 	// Все события обработаны успешно
-	successResponse(ctx, len(events))
+	successResponse(ctx, len(events), duplicates)
+}
+
+// finish завершает публикацию событий в кэше дедупликации: опубликованные он запоминает,
+// остальные забывает. results == nil — не принято ни одно событие
+func (h *StatusHandler) finish(reservations []dedup.Reservation, results []error) {
+	for i, reservation := range reservations {
+		h.dedup.Finish(reservation, results != nil && results[i] == nil)
+	}
+}
+
+// Health отвечает 200 если бэкенд публикации готов принимать события, иначе 503
+func (h *StatusHandler) Health(ctx *gin.Context) {
+	if err := h.publisher.Health(ctx.Request.Context()); err != nil {
+		if retryAfter := rabbitmq.RetryAfterHeader(err); retryAfter != "" {
+			ctx.Header("Retry-After", retryAfter)
+		}
+		errorResponse(ctx, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	ctx.Header("Content-Type", "application/json")
+	ctx.Status(http.StatusOK)
+	if err := json.NewEncoder(ctx.Writer).Encode(map[string]interface{}{
+		"status": "OK",
+	}); err != nil {
+		log.Printf("Failed to encode health response: %v", err)
+	}
 }
@@ -0,0 +1,87 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStoreReplay(t *testing.T) {
+	s := NewStore(time.Minute, 100)
+	if replay, err := s.Begin("key-1"); replay != nil || err != nil {
+		t.Fatalf("Begin() = %v, %v; want a new request", replay, err)
+	}
+	// Пока запрос обрабатывается, повтор получает ErrInFlight
+	if _, err := s.Begin("key-1"); !errors.Is(err, ErrInFlight) {
+		t.Fatalf("Begin() while in flight error = %v, want ErrInFlight", err)
+	}
+	body := []byte(`{"status":"SUCCESS"}`)
+	s.Finish("key-1", Response{Status: http.StatusOK, ContentType: "application/json", Body: body})
+	// Буфер ответа фреймворк может переиспользовать — хранилище держит свою копию
+	body[0] = 'x'
+	replay, err := s.Begin("key-1")
+	if err != nil || replay == nil {
+		t.Fatalf("Begin() after Finish = %v, %v; want the stored response", replay, err)
+	}
+	if replay.Status != http.StatusOK || replay.ContentType != "application/json" || string(replay.Body) != `{"status":"SUCCESS"}` {
+		t.Errorf("replay = %d %q %q", replay.Status, replay.ContentType, replay.Body)
+	}
+}
+
+// TestStoreTemporaryFailures проверяет, что 5xx и 429 не сохраняются и повтор обрабатывается заново
+func TestStoreTemporaryFailures(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		s := NewStore(time.Minute, 100)
+		if _, err := s.Begin("key-1"); err != nil {
+			t.Fatal(err)
+		}
+		s.Finish("key-1", Response{Status: status})
+		if replay, err := s.Begin("key-1"); replay != nil || err != nil {
+			t.Errorf("status %d: Begin() = %v, %v; want a new request", status, replay, err)
+		}
+	}
+	// 4xx кроме 429 — окончательный ответ
+	s := NewStore(time.Minute, 100)
+	if _, err := s.Begin("key-1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Finish("key-1", Response{Status: http.StatusBadRequest})
+	if replay, _ := s.Begin("key-1"); replay == nil || replay.Status != http.StatusBadRequest {
+		t.Errorf("Begin() = %v, want stored 400", replay)
+	}
+}
+
+func TestStoreExpires(t *testing.T) {
+	s := NewStore(20*time.Millisecond, 100)
+	if _, err := s.Begin("key-1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Finish("key-1", Response{Status: http.StatusOK})
+	time.Sleep(30 * time.Millisecond)
+	if replay, err := s.Begin("key-1"); replay != nil || err != nil {
+		t.Fatalf("Begin() after TTL = %v, %v; want a new request", replay, err)
+	}
+	// Ключ, для которого Finish так и не вызвали, освобождается по TTL
+	time.Sleep(30 * time.Millisecond)
+	if _, err := s.Begin("key-1"); err != nil {
+		t.Fatalf("Begin() after in-flight TTL error = %v, want a new request", err)
+	}
+}
+
+func TestStoreCapacity(t *testing.T) {
+	s := NewStore(time.Minute, 2)
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		if _, err := s.Begin(key); err != nil {
+			t.Fatal(err)
+		}
+		s.Finish(key, Response{Status: http.StatusOK})
+	}
+	if replay, _ := s.Begin("key-3"); replay == nil {
+		t.Error("key-3 is not stored")
+	}
+	// Самый старый ключ вытеснен
+	if replay, _ := s.Begin("key-1"); replay != nil {
+		t.Error("key-1 is still stored over capacity")
+	}
+}
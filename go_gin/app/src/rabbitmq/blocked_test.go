@@ -0,0 +1,107 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ex10se/http-perf-test/go_gin/rabbitmq/amqptest"
+)
+
+func TestBlocked(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, func(opts *Options) { opts.Breaker.FailureThreshold = 1 })
+	before := blockedConnections.Value()
+
+	server.Block("low on memory")
+	waitFor(t, "connection.blocked", client.Blocked)
+	if n := blockedConnections.Value() - before; n != 1 {
+		t.Errorf("rabbitmq_blocked_connections grew by %d, want 1", n)
+	}
+	err := client.Publish(context.Background(), QueueGolang, []byte(`{}`))
+	var blockedErr *BlockedError
+	if !errors.As(err, &blockedErr) || !errors.Is(err, ErrBlocked) {
+		t.Fatalf("Publish() error = %v, want BlockedError", err)
+	}
+	if blockedErr.Reason != "low on memory" {
+		t.Errorf("Reason = %q, want %q", blockedErr.Reason, "low on memory")
+	}
+	if got := RetryAfterHeader(err); got != "5" {
+		t.Errorf("RetryAfterHeader() = %q, want %q", got, "5")
+	}
+	if err := client.Health(context.Background()); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Health() = %v, want ErrBlocked", err)
+	}
+	// Блокировка — не отказ брокера: breaker остается замкнутым
+	if err := client.breaker.check(); err != nil {
+		t.Errorf("breaker opened on a blocked connection: %v", err)
+	}
+
+	server.Unblock()
+	waitFor(t, "connection.unblocked", func() bool { return !client.Blocked() })
+	if n := blockedConnections.Value() - before; n != 0 {
+		t.Errorf("rabbitmq_blocked_connections grew by %d after unblock, want 0", n)
+	}
+	if err := client.Publish(context.Background(), QueueGolang, []byte(`{}`)); err != nil {
+		t.Fatalf("Publish() after unblock = %v", err)
+	}
+	if err := client.Health(context.Background()); err != nil {
+		t.Errorf("Health() after unblock = %v", err)
+	}
+
+	// Блокировка относится к соединению и снимается при переподключении
+	server.Block("low on disk")
+	waitFor(t, "connection.blocked", client.Blocked)
+	first := current(client.conns[0])
+	server.CloseConnections()
+	waitFor(t, "reconnect", func() bool {
+		conn := current(client.conns[0])
+		return conn != nil && conn != first
+	})
+	if client.Blocked() {
+		t.Error("new connection is still blocked")
+	}
+	if n := blockedConnections.Value() - before; n != 0 {
+		t.Errorf("rabbitmq_blocked_connections grew by %d after reconnect, want 0", n)
+	}
+}
+
+// TestBlockedUsesUnblockedConnection проверяет, что при блокировке одного соединения
+// публикация идет через другие, а BlockedError возвращается только когда заблокированы все
+func TestBlockedUsesUnblockedConnection(t *testing.T) {
+	a, b := amqptest.NewServer(), amqptest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	declareQueues(t, a)
+	declareQueues(t, b)
+	client := newTestClient(t, a, func(opts *Options) {
+		opts.URLs = []string{a.URL(), b.URL()}
+		opts.Connections = 2
+		opts.PoolSize = 4
+	})
+	waitFor(t, "both connections", func() bool { return client.conns[0].connected() && client.conns[1].connected() })
+
+	a.Block("low on memory")
+	waitFor(t, "connection.blocked", client.Blocked)
+	for i := 0; i < 2*cap(client.pool); i++ {
+		if err := client.Publish(context.Background(), QueueGolang, []byte(`{}`)); err != nil {
+			t.Fatalf("Publish() with one blocked connection = %v", err)
+		}
+	}
+	if got, want := len(b.Messages(QueueGolang)), 2*cap(client.pool); got != want {
+		t.Errorf("node b has %d messages, want %d", got, want)
+	}
+	if err := client.Health(context.Background()); err != nil {
+		t.Errorf("Health() with one blocked connection = %v", err)
+	}
+
+	b.Block("low on disk")
+	waitFor(t, "both connections blocked", func() bool { return client.conns[1].blockedErr() != nil })
+	results := client.PublishBatch(context.Background(), testMessages())
+	for i, err := range results {
+		if !errors.Is(err, ErrBlocked) {
+			t.Errorf("result %d = %v, want ErrBlocked", i, err)
+		}
+	}
+}
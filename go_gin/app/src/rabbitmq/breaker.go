@@ -0,0 +1,185 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen — circuit breaker разомкнут, публикация не выполнялась
+var ErrCircuitOpen = errors.New("RabbitMQ circuit breaker is open")
+
+// CircuitOpenError возвращается пока circuit breaker разомкнут.
+// errors.Is(err, ErrCircuitOpen) возвращает true
+type CircuitOpenError struct {
+	// RetryAfter — сколько осталось до пробного запроса
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, retry in %ds", ErrCircuitOpen, retryAfterSeconds(e.RetryAfter))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// RetryAfterHeader возвращает значение заголовка Retry-After в секундах для ошибки публикации
+// или пустую строку, если ошибка не говорит когда повторять
+func RetryAfterHeader(err error) string {
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		return strconv.Itoa(retryAfterSeconds(openErr.RetryAfter))
+	}
+	var blockedErr *BlockedError
+	if errors.As(err, &blockedErr) {
+		return strconv.Itoa(retryAfterSeconds(blockedErr.RetryAfter))
+	}
+	return ""
+}
+
+// retryAfterSeconds округляет время ожидания вверх до целых секунд, не меньше одной
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// BreakerOptions содержит настройки circuit breaker
+type BreakerOptions struct {
+	// FailureThreshold — сколько публикаций подряд должно завершиться ошибкой брокера,
+	// чтобы breaker разомкнулся. 0 — breaker выключен
+	FailureThreshold int
+	// CoolDown — сколько breaker остается разомкнутым до пробной публикации
+	CoolDown time.Duration
+}
+
+// Состояния circuit breaker
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerState публикует состояние breaker в /debug/vars: 0 — closed, 1 — open, 2 — half-open
+var breakerState = new(expvar.Int)
+
+func init() {
+	expvar.Publish("rabbitmq_breaker_state", breakerState)
+}
+
+// breaker — circuit breaker вокруг публикации.
+// closed: публикации идут, ошибки подряд считаются;
+// open: публикации сразу получают CircuitOpenError до истечения CoolDown;
+// half-open: одна пробная публикация, ее успех замыкает breaker, ошибка снова размыкает
+type breaker struct {
+	opts     BreakerOptions
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	// now — источник времени, тесты подменяют его
+	now func() time.Time
+}
+
+// allow решает, можно ли публиковать. В half-open пропускает только одну пробу
+func (b *breaker) allow() error {
+	if b.opts.FailureThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if elapsed := b.now().Sub(b.openedAt); elapsed < b.opts.CoolDown {
+			return &CircuitOpenError{RetryAfter: b.opts.CoolDown - elapsed}
+		}
+		b.setState(breakerHalfOpen)
+		log.Println("RabbitMQ circuit breaker is half-open, probing")
+		return nil
+	case breakerHalfOpen:
+		// Проба уже идет, остальные ждут ее результата
+		return &CircuitOpenError{RetryAfter: time.Second}
+	default:
+		return nil
+	}
+}
+
+// check возвращает CircuitOpenError пока breaker разомкнут, не запуская пробу
+func (b *breaker) check() error {
+	if b.opts.FailureThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen {
+		if elapsed := b.now().Sub(b.openedAt); elapsed < b.opts.CoolDown {
+			return &CircuitOpenError{RetryAfter: b.opts.CoolDown - elapsed}
+		}
+	}
+	return nil
+}
+
+// record учитывает результат разрешенной публикации
+func (b *breaker) record(results []error) {
+	if b.opts.FailureThreshold <= 0 {
+		return
+	}
+	failed, neutral := classify(results)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case neutral:
+		// Запрос отменили до результата — проба не состоялась
+		if b.state == breakerHalfOpen {
+			b.setState(breakerOpen)
+			b.openedAt = b.now().Add(-b.opts.CoolDown)
+		}
+	case !failed:
+		if b.state != breakerClosed {
+			log.Println("RabbitMQ circuit breaker is closed")
+		}
+		b.failures = 0
+		b.setState(breakerClosed)
+	case b.state == breakerHalfOpen:
+		b.open()
+	default:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// open размыкает breaker
+func (b *breaker) open() {
+	b.failures = 0
+	b.openedAt = b.now()
+	b.setState(breakerOpen)
+	log.Printf("RabbitMQ circuit breaker is open for %v", b.opts.CoolDown)
+}
+
+func (b *breaker) setState(state int) {
+	b.state = state
+	breakerState.Set(int64(state))
+}
+
+// classify определяет, говорит ли результат публикации о проблеме с брокером.
+// Nack — ответ живого брокера, а отмена запроса и блокировка соединения
+// (ее отслеживает отдельное состояние) ничего не говорят о доступности брокера
+func classify(results []error) (failed, neutral bool) {
+	for _, err := range results {
+		switch {
+		case err == nil, errors.Is(err, ErrNacked):
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrBlocked):
+			neutral = true
+		default:
+			failed = true
+		}
+	}
+	return failed, neutral && !failed
+}
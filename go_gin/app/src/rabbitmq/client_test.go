@@ -0,0 +1,117 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go_gin/rabbitmq/amqptest"
+)
+
+// newTestClient подключает клиент к брокеру и декларирует топологию по умолчанию.
+// configure меняет настройки до создания клиента
+func newTestClient(t *testing.T, server *amqptest.Server, configure func(*Options)) *Client {
+	t.Helper()
+	opts := Options{
+		URLs:        []string{server.URL()},
+		Confirm:     true,
+		PoolSize:    1,
+		ConnectWait: 5 * time.Second,
+	}
+	if configure != nil {
+		configure(&opts)
+	}
+	client, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	if err := client.DeclareQueues(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// testMessages — сообщения в обе очереди топологии по умолчанию
+func testMessages() []Message {
+	return []Message{
+		{RoutingKey: QueueGolang, Body: []byte(`{"txId":"1"}`)},
+		{RoutingKey: QueueSystemGolang, Body: []byte(`{"txId":"2"}`)},
+		{RoutingKey: QueueGolang, Body: []byte(`{"txId":"3"}`)},
+	}
+}
+
+func checkResults(t *testing.T, results []error, want []error) {
+	t.Helper()
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i := range want {
+		if !errors.Is(results[i], want[i]) || (want[i] == nil) != (results[i] == nil) {
+			t.Errorf("result %d = %v, want %v", i, results[i], want[i])
+		}
+	}
+}
+
+func TestPublishBatchConfirm(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, nil)
+	checkResults(t, client.PublishBatch(context.Background(), testMessages()), []error{nil, nil, nil})
+	if golang, system := len(server.Messages(QueueGolang)), len(server.Messages(QueueSystemGolang)); golang != 2 || system != 1 {
+		t.Errorf("queues have %d and %d messages, want 2 and 1", golang, system)
+	}
+}
+
+// TestPublishBatchNack проверяет, что nack брокера возвращается только для отклоненных сообщений батча
+func TestPublishBatchNack(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, nil)
+	server.NackIf(func(m amqptest.Message) bool { return m.RoutingKey == QueueSystemGolang })
+	checkResults(t, client.PublishBatch(context.Background(), testMessages()), []error{nil, ErrNacked, nil})
+	if golang, system := len(server.Messages(QueueGolang)), len(server.Messages(QueueSystemGolang)); golang != 2 || system != 0 {
+		t.Errorf("queues have %d and %d messages, want 2 and 0", golang, system)
+	}
+	// Nack — ответ живого брокера: следующая публикация идет как обычно
+	server.NackIf(nil)
+	if err := client.Publish(context.Background(), QueueSystemGolang, []byte(`{}`)); err != nil {
+		t.Fatalf("Publish() after nack = %v", err)
+	}
+}
+
+func TestPublishNack(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, nil)
+	server.NackNext(1)
+	if err := client.Publish(context.Background(), QueueGolang, []byte(`{}`)); !errors.Is(err, ErrNacked) {
+		t.Fatalf("Publish() error = %v, want ErrNacked", err)
+	}
+}
+
+// TestPublishBatchWithoutConfirm проверяет, что без publisher confirms клиент не ждет ответа брокера
+func TestPublishBatchWithoutConfirm(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, func(opts *Options) { opts.Confirm = false })
+	checkResults(t, client.PublishBatch(context.Background(), testMessages()), []error{nil, nil, nil})
+	waitFor(t, "messages to be routed", func() bool {
+		return len(server.Messages(QueueGolang)) == 2 && len(server.Messages(QueueSystemGolang)) == 1
+	})
+}
+
+func TestPublishBatchCancelled(t *testing.T) {
+	server := amqptest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checkResults(t, client.PublishBatch(ctx, testMessages()), []error{context.Canceled, context.Canceled, context.Canceled})
+	if results := client.PublishBatch(context.Background(), nil); len(results) != 0 {
+		t.Errorf("empty batch returned %d results", len(results))
+	}
+}
@@ -0,0 +1,197 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codec сжимает тело сообщения перед публикацией.
+// Encoding проставляется в ContentEncoding, чтобы консьюмеры знали как распаковать тело
+type Codec interface {
+	// Encoding возвращает значение ContentEncoding ("" — тело не сжато)
+	Encoding() string
+	// Encode сжимает данные
+	Encode(data []byte) ([]byte, error)
+	// Decode распаковывает данные, сжатые Encode
+	Decode(data []byte) ([]byte, error)
+}
+
+// Названия кодеков, они же значения ContentEncoding
+const (
+	CodecNone   = "none"
+	CodecGzip   = "gzip"
+	CodecZstd   = "zstd"
+	CodecSnappy = "snappy"
+	CodecLZ4    = "lz4"
+)
+
+// NewCodec создает кодек по названию
+// gzipLevel используется только для gzip (gzip.DefaultCompression по умолчанию)
+func NewCodec(name string, gzipLevel int) (Codec, error) {
+	switch name {
+	case CodecNone, "identity", "":
+		return identityCodec{}, nil
+	case CodecGzip:
+		if gzipLevel < gzip.HuffmanOnly || gzipLevel > gzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip level %d", gzipLevel)
+		}
+		return newGzipCodec(gzipLevel), nil
+	case CodecZstd:
+		return newZstdCodec()
+	case CodecSnappy:
+		return snappyCodec{}, nil
+	case CodecLZ4:
+		return lz4Codec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+}
+
+// CodecForEncoding возвращает кодек для распаковки сообщения с указанным ContentEncoding
+func CodecForEncoding(encoding string) (Codec, error) {
+	return NewCodec(encoding, gzip.DefaultCompression)
+}
+
+// identityCodec публикует тело без сжатия
+type identityCodec struct{}
+
+func (identityCodec) Encoding() string { return "" }
+
+func (identityCodec) Encode(data []byte) ([]byte, error) { return data, nil }
+
+func (identityCodec) Decode(data []byte) ([]byte, error) { return data, nil }
+
+// bufferPool переиспользует буферы для сжатия между публикациями
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// gzipCodec сжимает тело с помощью gzip с заданным уровнем
+// gzip.Writer держит ~800KB внутреннего состояния, поэтому writers переиспользуются через Reset
+type gzipCodec struct {
+	level   int
+	writers sync.Pool
+}
+
+// newGzipCodec создает gzip кодек, level должен быть уже проверен
+func newGzipCodec(level int) *gzipCodec {
+	c := &gzipCodec{level: level}
+	c.writers.New = func() any {
+		gzipWriter, _ := gzip.NewWriterLevel(io.Discard, level)
+		return gzipWriter
+	}
+	return c
+}
+
+func (*gzipCodec) Encoding() string { return CodecGzip }
+
+func (c *gzipCodec) Encode(data []byte) ([]byte, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	gzipWriter := c.writers.Get().(*gzip.Writer)
+	defer c.writers.Put(gzipWriter)
+	gzipWriter.Reset(buf)
+	if _, err := gzipWriter.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	// Буфер вернется в пул, поэтому результат копируем
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+func (*gzipCodec) Decode(data []byte) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = gzipReader.Close()
+	}()
+	return io.ReadAll(gzipReader)
+}
+
+// zstdCodec сжимает тело с помощью zstd
+// EncodeAll/DecodeAll безопасны для конкурентного использования
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCodec() (Codec, error) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	return &zstdCodec{encoder: encoder, decoder: decoder}, nil
+}
+
+func (*zstdCodec) Encoding() string { return CodecZstd }
+
+func (c *zstdCodec) Encode(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCodec) Decode(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
+
+// snappyCodec сжимает тело в блочном формате snappy
+type snappyCodec struct{}
+
+func (snappyCodec) Encoding() string { return CodecSnappy }
+
+func (snappyCodec) Encode(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCodec) Decode(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// lz4Writers переиспользует lz4 writers через Reset так же как gzipCodec
+var lz4Writers = sync.Pool{
+	New: func() any {
+		return lz4.NewWriter(io.Discard)
+	},
+}
+
+// lz4Codec сжимает тело в кадровом формате lz4
+type lz4Codec struct{}
+
+func (lz4Codec) Encoding() string { return CodecLZ4 }
+
+func (lz4Codec) Encode(data []byte) ([]byte, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	lz4Writer := lz4Writers.Get().(*lz4.Writer)
+	defer lz4Writers.Put(lz4Writer)
+	lz4Writer.Reset(buf)
+	if _, err := lz4Writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := lz4Writer.Close(); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+func (lz4Codec) Decode(data []byte) ([]byte, error) {
+	return io.ReadAll(lz4.NewReader(bytes.NewReader(data)))
+}
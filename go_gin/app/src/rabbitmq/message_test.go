@@ -0,0 +1,115 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/ex10se/http-perf-test/go_gin/models"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestNewMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        models.StatusEvent
+		wantKey      string
+		wantPriority *uint8
+		wantHeaders  amqp.Table
+	}{
+		{
+			name:    "plain event",
+			event:   models.StatusEvent{State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-1"},
+			wantKey: QueueGolang,
+		},
+		{
+			name: "system event with priority and channel",
+			event: models.StatusEvent{
+				State: "FAILED", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-2",
+				TrackData: &models.TrackData{Priority: ptr(7), IsSystem: true},
+				Channel:   ptr("email"), ChannelID: ptr("42"),
+			},
+			wantKey:      QueueSystemGolang,
+			wantPriority: ptr(uint8(7)),
+			wantHeaders:  amqp.Table{"channel": "email", "channel_id": "42"},
+		},
+		{
+			name: "channel id only",
+			event: models.StatusEvent{
+				State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-3",
+				TrackData: &models.TrackData{}, ChannelID: ptr("42"),
+			},
+			wantKey:     QueueGolang,
+			wantHeaders: amqp.Table{"channel_id": "42"},
+		},
+		{
+			name: "priority above the AMQP range",
+			event: models.StatusEvent{
+				State: "SUCCESS", UpdatedAt: "2024-05-01T12:00:00Z", TxID: "tx-4",
+				TrackData: &models.TrackData{Priority: ptr(1000)},
+			},
+			wantKey:      QueueGolang,
+			wantPriority: ptr(uint8(models.MaxPriority)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			message, err := NewMessage(&tt.event, DefaultRouter(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.RoutingKey != tt.wantKey || message.Exchange != "" {
+				t.Errorf("route = %q %q, want %q", message.Exchange, message.RoutingKey, tt.wantKey)
+			}
+			if message.MessageID != tt.event.TxID || message.Type != tt.event.State {
+				t.Errorf("MessageID, Type = %q, %q; want %q, %q", message.MessageID, message.Type, tt.event.TxID, tt.event.State)
+			}
+			if message.Timestamp.Before(before) || message.Timestamp.After(time.Now()) {
+				t.Errorf("Timestamp = %v, want the publish time", message.Timestamp)
+			}
+			if (message.Priority == nil) != (tt.wantPriority == nil) ||
+				message.Priority != nil && *message.Priority != *tt.wantPriority {
+				t.Errorf("Priority = %v, want %v", message.Priority, tt.wantPriority)
+			}
+			if len(message.Headers) != len(tt.wantHeaders) {
+				t.Errorf("Headers = %v, want %v", message.Headers, tt.wantHeaders)
+			}
+			for key, want := range tt.wantHeaders {
+				if message.Headers[key] != want {
+					t.Errorf("Headers[%q] = %v, want %v", key, message.Headers[key], want)
+				}
+			}
+			var body models.StatusEvent
+			if err := json.Unmarshal(message.Body, &body); err != nil || body.TxID != tt.event.TxID {
+				t.Errorf("Body = %s, want the event JSON", message.Body)
+			}
+		})
+	}
+}
+
+// TestClientPriority проверяет, что приоритет выше x-max-priority очередей понижается до MaxPriority
+func TestClientPriority(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultPriority int
+		maxPriority     int
+		priority        *uint8
+		want            uint8
+	}{
+		{name: "default", defaultPriority: 3, want: 3},
+		{name: "event priority", defaultPriority: 3, priority: ptr(uint8(8)), want: 8},
+		{name: "clamped to max priority", maxPriority: 10, priority: ptr(uint8(200)), want: 10},
+		{name: "default clamped to max priority", defaultPriority: 5, maxPriority: 4, want: 4},
+		{name: "queues without priorities", priority: ptr(uint8(200)), want: 200},
+	}
+	for _, tt := range tests {
+		c := &Client{opts: Options{DefaultPriority: tt.defaultPriority, Queues: QueueOptions{MaxPriority: tt.maxPriority}}}
+		if got := c.priority(tt.priority); got != tt.want {
+			t.Errorf("%s: priority() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
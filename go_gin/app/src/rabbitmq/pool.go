@@ -0,0 +1,296 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Порядок перебора узлов кластера при подключении
+const (
+	// FailoverRoundRobin распределяет соединения по узлам и после обрыва
+	// начинает со следующего узла, а не с того, который только что отвалился
+	FailoverRoundRobin = "round-robin"
+	// FailoverPriority всегда начинает с первого узла списка, остальные — резервные
+	FailoverPriority = "priority"
+)
+
+// connection представляет одно TCP соединение с RabbitMQ,
+// поверх которого открываются каналы пула.
+// Соединение поддерживается фоновой горутиной supervise
+type connection struct {
+	id       int
+	urls     []string
+	failover string
+	// config — настройки подключения: TLS и механизм аутентификации
+	config amqp.Config
+	// next — индекс узла, с которого начнется следующая попытка подключения
+	next int
+	mu   sync.Mutex
+	// conn — текущее соединение, nil пока брокер недоступен
+	conn *amqp.Connection
+	// ready закрывается когда соединение установлено
+	ready chan struct{}
+	// blocked — брокер прислал connection.blocked и не принимает публикации
+	blocked       bool
+	blockedReason string
+	blockedAt     time.Time
+}
+
+// pooledChannel — слот пула каналов.
+// Между acquire и release слотом владеет ровно одна горутина
+type pooledChannel struct {
+	id      int
+	conn    *connection
+	channel *amqp.Channel
+	// closed получает уведомление когда брокер закрыл канал
+	closed chan *amqp.Error
+}
+
+// newPool создает соединения и пустые слоты каналов.
+// Сами каналы открываются лениво при первом использовании слота
+func newPool(urls []string, failover string, config amqp.Config, size, connections int) ([]*connection, chan *pooledChannel) {
+	conns := make([]*connection, connections)
+	for i := range conns {
+		conns[i] = &connection{id: i, urls: urls, failover: failover, config: config, ready: make(chan struct{})}
+		// Соединения изначально распределяются по узлам кластера
+		if failover == FailoverRoundRobin {
+			conns[i].next = i % len(urls)
+		}
+	}
+	pool := make(chan *pooledChannel, size)
+	for i := 0; i < size; i++ {
+		// Каналы распределяются между соединениями по кругу
+		pool <- &pooledChannel{id: i, conn: conns[i%connections]}
+	}
+	return conns, pool
+}
+
+// supervise устанавливает соединение и восстанавливает его после NotifyClose
+// Работает в фоне до закрытия done, поэтому HTTP запросы никогда не ждут backoff
+func (c *connection) supervise(done <-chan struct{}) {
+	attempt := 0
+	for {
+		conn, node, err := c.dial()
+		if err != nil {
+			// Exponential backoff: 1s, 2s, 4s, 8s, 16s, 16s, ...
+			waitTime := time.Duration(1<<uint(min(attempt, 4))) * time.Second
+			attempt++
+			log.Printf("Failed to connect to RabbitMQ (connection %d): %v, retrying in %v (attempt %d)", c.id, err, waitTime, attempt)
+			select {
+			case <-time.After(waitTime):
+				continue
+			case <-done:
+				return
+			}
+		}
+		attempt = 0
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		blockings := conn.NotifyBlocked(make(chan amqp.Blocking, 1))
+		c.mu.Lock()
+		c.conn = conn
+		close(c.ready)
+		c.mu.Unlock()
+		log.Printf("Connected to RabbitMQ node %s (connection %d)", node, c.id)
+		go c.watchBlocked(conn, node, blockings)
+		select {
+		case amqpErr := <-closed:
+			log.Printf("RabbitMQ connection %d to node %s closed: %v, reconnecting...", c.id, node, amqpErr)
+			c.mu.Lock()
+			c.conn = nil
+			c.ready = make(chan struct{})
+			c.setUnblocked()
+			c.mu.Unlock()
+		case <-done:
+			c.mu.Lock()
+			if err := conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+				log.Printf("Error closing connection %d: %v", c.id, err)
+			}
+			c.conn = nil
+			c.setUnblocked()
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// dial перебирает узлы кластера начиная с c.next и подключается к первому доступному.
+// Backoff в supervise начинается только когда недоступны все узлы
+func (c *connection) dial() (*amqp.Connection, string, error) {
+	var errs []error
+	for i := range c.urls {
+		index := (c.next + i) % len(c.urls)
+		node := nodeName(c.urls[index])
+		config := c.config
+		// DialConfig записывает ServerName в tls.Config, а узлы и соединения его разделяют
+		if config.TLSClientConfig != nil {
+			config.TLSClientConfig = config.TLSClientConfig.Clone()
+		}
+		conn, err := amqp.DialConfig(c.urls[index], config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", node, err))
+			continue
+		}
+		// После обрыва round-robin переходит к следующему узлу
+		if c.failover == FailoverRoundRobin {
+			c.next = (index + 1) % len(c.urls)
+		}
+		return conn, node, nil
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// nodeName возвращает адрес узла из URL без логина и пароля
+func nodeName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return u.Host
+}
+
+// NodeNames возвращает адреса узлов из URL без логинов и паролей — для логов
+func NodeNames(urls []string) []string {
+	nodes := make([]string, len(urls))
+	for i, rawURL := range urls {
+		nodes[i] = nodeName(rawURL)
+	}
+	return nodes
+}
+
+// connected сообщает, установлено ли соединение сейчас
+func (c *connection) connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil && !c.conn.IsClosed()
+}
+
+// available сообщает, что соединение установлено и брокер его не заблокировал
+func (c *connection) available() bool {
+	return c.connected() && c.blockedErr() == nil
+}
+
+// get возвращает активное соединение.
+// Если брокер недоступен, ждет переподключения не дольше wait и возвращает ErrUnavailable.
+// Отмена ctx прерывает ожидание
+func (c *connection) get(ctx context.Context, wait time.Duration) (*amqp.Connection, error) {
+	c.mu.Lock()
+	conn, ready := c.conn, c.ready
+	c.mu.Unlock()
+	if conn != nil && !conn.IsClosed() {
+		return conn, nil
+	}
+	if wait <= 0 {
+		return nil, ErrUnavailable
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return c.get(ctx, 0)
+	case <-timer.C:
+		return nil, ErrUnavailable
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquire забирает слот из пула и гарантирует что его канал открыт.
+// Слоты соединений, которые сейчас переподключаются или заблокированы брокером, пропускаются
+// пока есть соединение, готовое принять публикацию: ErrUnavailable возвращается только
+// если брокер недоступен целиком, а слот заблокированного соединения — только если заблокированы все.
+// Слот необходимо вернуть через release
+func (c *Client) acquire(ctx context.Context, wait time.Duration) (*pooledChannel, error) {
+	for skipped := 0; ; skipped++ {
+		var pc *pooledChannel
+		select {
+		case pc = <-c.pool:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// Возвращенный слот встает в конец пула, поэтому за cap(c.pool) попыток перебираются все слоты
+		if skipped < cap(c.pool) && !pc.conn.available() && c.available() {
+			c.release(pc)
+			continue
+		}
+		if pc.isOpen() {
+			return pc, nil
+		}
+		if err := c.openChannel(ctx, pc, wait); err != nil {
+			c.release(pc)
+			return nil, err
+		}
+		return pc, nil
+	}
+}
+
+// available сообщает, есть ли соединение, готовое принять публикацию
+func (c *Client) available() bool {
+	for _, conn := range c.conns {
+		if conn.available() {
+			return true
+		}
+	}
+	return false
+}
+
+// release возвращает слот в пул
+func (c *Client) release(pc *pooledChannel) {
+	c.pool <- pc
+}
+
+// openChannel открывает новый канал для слота взамен закрытого
+func (c *Client) openChannel(ctx context.Context, pc *pooledChannel, wait time.Duration) error {
+	pc.discard()
+	conn, err := pc.conn.get(ctx, wait)
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	// Включаем режим подтверждений
+	if c.opts.Confirm {
+		if err := channel.Confirm(false); err != nil {
+			_ = channel.Close()
+			return fmt.Errorf("failed to put channel into confirm mode: %w", err)
+		}
+	}
+	pc.channel = channel
+	pc.closed = channel.NotifyClose(make(chan *amqp.Error, 1))
+	return nil
+}
+
+// isOpen проверяет что канал слота открыт и брокер не прислал channel.close
+func (pc *pooledChannel) isOpen() bool {
+	if pc.channel == nil || pc.channel.IsClosed() {
+		return false
+	}
+	select {
+	case amqpErr := <-pc.closed:
+		log.Printf("RabbitMQ channel %d closed: %v", pc.id, amqpErr)
+		return false
+	default:
+		return true
+	}
+}
+
+// discard закрывает канал слота после ошибки.
+// Новый канал будет открыт при следующем acquire, остальные слоты не затрагиваются
+func (pc *pooledChannel) discard() {
+	if pc.channel == nil {
+		return
+	}
+	if !pc.channel.IsClosed() {
+		_ = pc.channel.Close()
+	}
+	pc.channel = nil
+	pc.closed = nil
+}
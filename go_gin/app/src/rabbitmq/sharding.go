@@ -0,0 +1,31 @@
+package rabbitmq
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// ShardQueueName возвращает имя очереди-шарда, оно же ключ маршрутизации шарда: "<queue>.<shard>"
+func ShardQueueName(queueName string, shard int) string {
+	return queueName + "." + strconv.Itoa(shard)
+}
+
+// shardOf выбирает шард для txId.
+// Все события одной транзакции попадают в один шард и читаются одним консьюмером по порядку
+func shardOf(txID string, shards int) int {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(txID))
+	return jumpHash(hash.Sum64(), shards)
+}
+
+// jumpHash — jump consistent hash (Lamping, Veach, 2014).
+// При увеличении числа шардов с N до N+1 переезжает только 1/(N+1) ключей
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
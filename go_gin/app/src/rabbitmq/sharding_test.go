@@ -0,0 +1,80 @@
+package rabbitmq
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestJumpHash сверяет jumpHash с эталонными значениями реализаций из статьи
+func TestJumpHash(t *testing.T) {
+	tests := []struct {
+		key     uint64
+		buckets int
+		want    int
+	}{
+		{1, 1, 0},
+		{42, 57, 43},
+		{0xDEAD10CC, 1, 0},
+		{0xDEAD10CC, 666, 361},
+		{256, 1024, 520},
+	}
+	for _, tt := range tests {
+		if got := jumpHash(tt.key, tt.buckets); got != tt.want {
+			t.Errorf("jumpHash(%d, %d) = %d, want %d", tt.key, tt.buckets, got, tt.want)
+		}
+	}
+}
+
+// TestShardOf проверяет, что шард транзакции не меняется между запусками
+// и что транзакции распределяются по шардам равномерно
+func TestShardOf(t *testing.T) {
+	// Шард зависит только от txId: консьюмеры рассчитывают на постоянство между релизами
+	stable := []struct {
+		txID   string
+		shards int
+		want   int
+	}{
+		{"tx-1", 8, 3},
+		{"tx-2", 8, 5},
+		{"tx-2", 16, 12},
+		{"7f0c2a4e-5b1d-4c1e-9a3f-2d8e6b9c0a11", 8, 7},
+	}
+	for _, tt := range stable {
+		if got := shardOf(tt.txID, tt.shards); got != tt.want {
+			t.Errorf("shardOf(%q, %d) = %d, want %d", tt.txID, tt.shards, got, tt.want)
+		}
+	}
+
+	const shards, keys = 8, 80000
+	counts := make([]int, shards)
+	for i := 0; i < keys; i++ {
+		counts[shardOf("tx-"+strconv.Itoa(i), shards)]++
+	}
+	// Отклонение от keys/shards не больше 5%
+	for shard, count := range counts {
+		if expected := keys / shards; count < expected*95/100 || count > expected*105/100 {
+			t.Errorf("shard %d has %d of %d keys, want about %d", shard, count, keys, expected)
+		}
+	}
+}
+
+// TestShardOfGrowth проверяет, что при добавлении шарда ключи переезжают только в новый шард
+func TestShardOfGrowth(t *testing.T) {
+	const keys = 10000
+	moved := 0
+	for i := 0; i < keys; i++ {
+		txID := "tx-" + strconv.Itoa(i)
+		before, after := shardOf(txID, 8), shardOf(txID, 9)
+		if before == after {
+			continue
+		}
+		if after != 8 {
+			t.Fatalf("%s moved from shard %d to old shard %d", txID, before, after)
+		}
+		moved++
+	}
+	// Переезжает примерно 1/9 ключей
+	if moved < keys/9*80/100 || moved > keys/9*120/100 {
+		t.Errorf("%d of %d keys moved, want about %d", moved, keys, keys/9)
+	}
+}
@@ -0,0 +1,386 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go_gin/rabbitmq/amqptest"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestSpoolable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{ErrUnavailable, true},
+		{fmt.Errorf("%w after %d attempts: %w", ErrPublishFailed, 5, errors.New("channel/connection is not open")), true},
+		{ErrConfirmTimeout, true},
+		{ErrConfirmLost, true},
+		{&BlockedError{Reason: "low on memory"}, true},
+		{&CircuitOpenError{}, true},
+		{ErrNacked, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := spoolable(tt.err); got != tt.want {
+			t.Errorf("spoolable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSpoolAppendPeekCommit(t *testing.T) {
+	s, err := openSpool(SpoolOptions{Dir: t.TempDir(), Fsync: FsyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = s.close()
+	}()
+	envelopes := []envelope{{RoutingKey: "a"}, {RoutingKey: "b"}, {RoutingKey: "c"}}
+	if err := s.append(envelopes); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := s.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.envelopes) != 3 {
+		t.Fatalf("peek returned %d records, want 3", len(batch.envelopes))
+	}
+	if err := s.commit(batch, 2); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := s.depth(); records != 1 {
+		t.Fatalf("depth = %d records after commit, want 1", records)
+	}
+	batch, err = s.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.envelopes) != 1 || batch.envelopes[0].RoutingKey != "c" {
+		t.Fatalf("peek after commit returned %+v, want record c", batch.envelopes)
+	}
+}
+
+// openTestSpool открывает спул в dir и закрывает его по завершении теста
+func openTestSpool(t *testing.T, opts SpoolOptions) *spool {
+	t.Helper()
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncNever
+	}
+	s, err := openSpool(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.close()
+	})
+	return s
+}
+
+func checkDepth(t *testing.T, s *spool, want int64) {
+	t.Helper()
+	if records, _ := s.depth(); records != want {
+		t.Fatalf("depth = %d records, want %d", records, want)
+	}
+}
+
+func routingKeys(batch spoolBatch) []string {
+	keys := make([]string, len(batch.envelopes))
+	for i, env := range batch.envelopes {
+		keys[i] = env.RoutingKey
+	}
+	return keys
+}
+
+// TestSpoolRecovery проверяет, что после перезапуска дренаж продолжается с сохраненной позиции
+func TestSpoolRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(SpoolOptions{Dir: dir, Fsync: FsyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]envelope{{RoutingKey: "a"}, {RoutingKey: "b"}, {RoutingKey: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := s.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(batch, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, spoolCheckpointFile)); err != nil {
+		t.Fatalf("checkpoint is not saved: %v", err)
+	}
+
+	s = openTestSpool(t, SpoolOptions{Dir: dir})
+	checkDepth(t, s, 2)
+	batch, err = s.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := routingKeys(batch); !slices.Equal(keys, []string{"b", "c"}) {
+		t.Fatalf("peek after restart = %v, want [b c]", keys)
+	}
+	// Старый сегмент после перезапуска не дописывается, новые записи идут в следующий
+	if err := s.append([]envelope{{RoutingKey: "d"}}); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := listSegments(dir); len(segments) != 2 {
+		t.Fatalf("segments = %v, want 2", segments)
+	}
+	if !batch.segmentDone {
+		t.Fatal("segment written before restart is not reported as done")
+	}
+	if err := s.commit(batch, len(batch.envelopes)); err != nil {
+		t.Fatal(err)
+	}
+	batch, err = s.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := routingKeys(batch); !slices.Equal(keys, []string{"d"}) {
+		t.Fatalf("peek after first segment = %v, want [d]", keys)
+	}
+}
+
+// TestSpoolRotation проверяет переход в новый сегмент и удаление отправленных сегментов
+func TestSpoolRotation(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, SpoolOptions{Dir: dir, SegmentBytes: 1})
+	for _, key := range []string{"a", "b", "c"} {
+		if err := s.append([]envelope{{RoutingKey: key}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if segments, _ := listSegments(dir); len(segments) != 3 {
+		t.Fatalf("segments = %v, want 3", segments)
+	}
+	var replayed []string
+	for range 10 {
+		batch, err := s.peek(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch.envelopes) == 0 && !batch.segmentDone {
+			break
+		}
+		replayed = append(replayed, routingKeys(batch)...)
+		if err := s.commit(batch, len(batch.envelopes)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(replayed, []string{"a", "b", "c"}) {
+		t.Fatalf("replayed %v, want [a b c]", replayed)
+	}
+	checkDepth(t, s, 0)
+	// Текущий сегмент еще пишется, остальные удалены
+	if segments, _ := listSegments(dir); len(segments) != 1 {
+		t.Fatalf("segments after drain = %v, want only the current one", segments)
+	}
+}
+
+// TestSpoolDamagedTail проверяет, что оборванная или поврежденная последняя запись
+// после падения не считается и не читается
+func TestSpoolDamagedTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(data []byte) []byte
+	}{
+		{"truncated", func(data []byte) []byte { return data[:len(data)-3] }},
+		{"truncated header", func(data []byte) []byte { return data[:len(data)-len(data)/2+spoolHeaderSize/2] }},
+		{"corrupt", func(data []byte) []byte {
+			data[len(data)-2] ^= 0xFF
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := openSpool(SpoolOptions{Dir: dir, Fsync: FsyncNever})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.append([]envelope{{RoutingKey: "a"}, {RoutingKey: "b"}}); err != nil {
+				t.Fatal(err)
+			}
+			path := s.segmentPath(s.writerSeq)
+			if err := s.close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.damage(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s = openTestSpool(t, SpoolOptions{Dir: dir})
+			checkDepth(t, s, 1)
+			batch, err := s.peek(10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys := routingKeys(batch); !slices.Equal(keys, []string{"a"}) {
+				t.Fatalf("peek = %v, want [a]", keys)
+			}
+		})
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	s := openTestSpool(t, SpoolOptions{Dir: t.TempDir(), MaxBytes: 400})
+	if err := s.append([]envelope{{RoutingKey: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]envelope{{RoutingKey: "b"}, {RoutingKey: "c"}}); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("append over MaxBytes: error = %v, want ErrSpoolFull", err)
+	}
+	checkDepth(t, s, 1)
+	// Отправленные записи освобождают место
+	batch, err := s.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(batch, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]envelope{{RoutingKey: "b"}}); err != nil {
+		t.Fatalf("append after drain: %v", err)
+	}
+}
+
+// spoolEnvelopes — сообщения в очередь Golang для дренажа
+func spoolEnvelopes(n int) []envelope {
+	envelopes := make([]envelope, n)
+	for i := range envelopes {
+		envelopes[i] = envelope{
+			RoutingKey: QueueGolang,
+			Publishing: amqp.Publishing{ContentType: "application/json", Body: []byte(fmt.Sprintf(`{"txId":"%d"}`, i))},
+		}
+	}
+	return envelopes
+}
+
+// declareQueues создает очереди топологии по умолчанию на брокере
+func declareQueues(t *testing.T, server *amqptest.Server) {
+	t.Helper()
+	client, err := New(Options{URLs: []string{server.URL()}, PoolSize: 1, ConnectWait: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	if err := client.DeclareQueues(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor ждет, пока условие выполнится, не дольше 5 секунд
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestSpoolDrain проверяет, что клиент при старте публикует сообщения, оставшиеся в спуле,
+// и пропускает отклоненные брокером
+func TestSpoolDrain(t *testing.T) {
+	tests := []struct {
+		name      string
+		nacked    int
+		published int
+	}{
+		{"all published", 0, 3},
+		{"nacked are dropped", 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := amqptest.NewServer()
+			defer server.Close()
+			declareQueues(t, server)
+			dir := t.TempDir()
+			s, err := openSpool(SpoolOptions{Dir: dir, Fsync: FsyncNever})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.append(spoolEnvelopes(3)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.close(); err != nil {
+				t.Fatal(err)
+			}
+			server.NackNext(tt.nacked)
+			client, err := New(Options{
+				URLs:        []string{server.URL()},
+				Confirm:     true,
+				PoolSize:    1,
+				ConnectWait: 5 * time.Second,
+				Spool:       SpoolOptions{Dir: dir, Fsync: FsyncNever},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+			waitFor(t, "spool to drain", func() bool {
+				records, _ := client.spool.depth()
+				return records == 0
+			})
+			if messages := server.Messages(QueueGolang); len(messages) != tt.published {
+				t.Fatalf("%d messages published from spool, want %d", len(messages), tt.published)
+			}
+		})
+	}
+}
+
+// TestSpoolFailed проверяет, что при недоступном брокере сообщения уходят в спул
+// и считаются принятыми
+func TestSpoolFailed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "amqp://guest:guest@" + listener.Addr().String() + "/"
+	_ = listener.Close()
+	client, err := New(Options{
+		URLs:        []string{url},
+		PoolSize:    1,
+		ConnectWait: 100 * time.Millisecond,
+		Spool:       SpoolOptions{Dir: t.TempDir(), Fsync: FsyncNever},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	results := client.PublishBatch(context.Background(), []Message{{RoutingKey: QueueGolang, Body: []byte(`{}`)}})
+	if results[0] != nil {
+		t.Fatalf("PublishBatch() = %v, want the message spooled", results[0])
+	}
+	if records, _ := client.spool.depth(); records != 1 {
+		t.Fatalf("spool depth = %d, want 1", records)
+	}
+}
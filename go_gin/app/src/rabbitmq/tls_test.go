@@ -0,0 +1,263 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go_gin/rabbitmq/amqptest"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// testPKI — CA, сертификат брокера и клиентский сертификат для SASL EXTERNAL
+type testPKI struct {
+	caPool   *x509.CertPool
+	server   tls.Certificate
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+// clientName — CommonName клиентского сертификата, по нему брокер аутентифицирует клиента
+const clientName = "perf-test-client"
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey := newKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "perf-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki := &testPKI{caPool: x509.NewCertPool()}
+	pki.caPool.AddCert(ca)
+	pki.caFile = writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(serial int64, template *x509.Certificate) ([]byte, *ecdsa.PrivateKey) {
+		key := newKey(t)
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+	serverDER, serverKey := issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: clientName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	pki.certFile = writePEM(t, dir, "client.pem", "CERTIFICATE", clientDER)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki.keyFile = writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+	return pki
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serverTLS — настройки брокера, который требует клиентский сертификат от нашего CA
+func (p *testPKI) serverTLS() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.server},
+		ClientCAs:    p.caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	config, err := TLSOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile, ServerName: "localhost"}.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerName != "localhost" || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("ServerName = %q, MinVersion = %x", config.ServerName, config.MinVersion)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 {
+		t.Fatalf("RootCAs = %v, %d client certificates", config.RootCAs, len(config.Certificates))
+	}
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{"missing CA file", TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", TLSOptions{CAFile: pki.keyFile}},
+		{"certificate without key", TLSOptions{CertFile: pki.certFile}},
+		{"key without certificate", TLSOptions{KeyFile: pki.keyFile}},
+		{"mismatched key", TLSOptions{CertFile: pki.caFile, KeyFile: pki.keyFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.opts.tlsConfig(); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDialConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	config, err := dialConfig(TLSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSClientConfig != nil || config.SASL != nil {
+		t.Errorf("without TLS options: TLSClientConfig = %v, SASL = %v", config.TLSClientConfig, config.SASL)
+	}
+	if _, err := dialConfig(TLSOptions{CAFile: pki.caFile, External: true}); err == nil {
+		t.Error("SASL EXTERNAL without client certificate: expected error")
+	}
+	config, err = dialConfig(TLSOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile, External: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSClientConfig == nil {
+		t.Fatal("TLSClientConfig is not set")
+	}
+	if len(config.SASL) != 1 || config.SASL[0].Mechanism() != "EXTERNAL" {
+		t.Fatalf("SASL = %v, want EXTERNAL", config.SASL)
+	}
+}
+
+// TestTLSExternal подключается к брокеру по amqps:// и аутентифицируется клиентским сертификатом
+func TestTLSExternal(t *testing.T) {
+	pki := newTestPKI(t)
+	server := amqptest.NewTLSServer(pki.serverTLS())
+	defer server.Close()
+	client, err := New(Options{
+		URLs:        []string{server.URL()},
+		TLS:         TLSOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile, External: true},
+		Confirm:     true,
+		PoolSize:    1,
+		ConnectWait: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	if err := client.DeclareQueues(); err != nil {
+		t.Fatal(err)
+	}
+	results := client.PublishBatch(context.Background(), []Message{{RoutingKey: QueueGolang, Body: []byte(`{"txId":"1"}`)}})
+	if results[0] != nil {
+		t.Fatalf("publish over TLS failed: %v", results[0])
+	}
+	if messages := server.Messages(QueueGolang); len(messages) != 1 {
+		t.Errorf("queue %s has %d messages, want 1", QueueGolang, len(messages))
+	}
+	if mechanisms := server.Mechanisms(); len(mechanisms) == 0 || slices.ContainsFunc(mechanisms, func(m string) bool { return m != "EXTERNAL" }) {
+		t.Errorf("SASL mechanisms = %v, want EXTERNAL", mechanisms)
+	}
+	if names := server.ClientNames(); !slices.Contains(names, clientName) {
+		t.Errorf("client certificates = %v, want %s", names, clientName)
+	}
+}
+
+// TestTLSPlain проверяет что без External используются логин и пароль из URL поверх TLS
+func TestTLSPlain(t *testing.T) {
+	pki := newTestPKI(t)
+	server := amqptest.NewTLSServer(pki.serverTLS())
+	defer server.Close()
+	config, err := dialConfig(TLSOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := amqp.DialConfig(server.URL(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if mechanisms := server.Mechanisms(); !slices.Equal(mechanisms, []string{"PLAIN"}) {
+		t.Errorf("SASL mechanisms = %v, want PLAIN", mechanisms)
+	}
+}
+
+// TestTLSRejected проверяет что без клиентского сертификата или с чужим CA брокер недоступен
+func TestTLSRejected(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestPKI(t)
+	server := amqptest.NewTLSServer(pki.serverTLS())
+	defer server.Close()
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{"without client certificate", TLSOptions{CAFile: pki.caFile}},
+		{"untrusted server", TLSOptions{CAFile: other.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile}},
+		{"untrusted client", TLSOptions{CAFile: pki.caFile, CertFile: other.certFile, KeyFile: other.keyFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(Options{URLs: []string{server.URL()}, TLS: tt.opts, PoolSize: 1, ConnectWait: 300 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+			err = client.Publish(context.Background(), QueueGolang, []byte(`{}`))
+			if !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("Publish() error = %v, want ErrUnavailable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package dedup
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// begin вызывает Begin, проверяет результат и возвращает резервацию
+func begin(t *testing.T, c *Cache, key string, wantDuplicate bool, wantErr error) Reservation {
+	t.Helper()
+	reservation, duplicate, err := c.Begin(key)
+	if duplicate != wantDuplicate || !errors.Is(err, wantErr) {
+		t.Fatalf("Begin(%q) = %v, %v; want %v, %v", key, duplicate, err, wantDuplicate, wantErr)
+	}
+	return reservation
+}
+
+func TestCachePublished(t *testing.T) {
+	c := New(time.Minute, 100, 1)
+	reservation := begin(t, c, "tx-1", false, nil)
+	// Пока событие публикуется, повтор не подтверждается как дубликат
+	begin(t, c, "tx-1", false, ErrInFlight)
+	c.Finish(reservation, true)
+	begin(t, c, "tx-1", true, nil)
+}
+
+func TestCacheNotPublished(t *testing.T) {
+	c := New(time.Minute, 100, 1)
+	c.Finish(begin(t, c, "tx-1", false, nil), false)
+	// Неопубликованное событие повтор должен опубликовать
+	begin(t, c, "tx-1", false, nil)
+}
+
+func TestCacheFinishAfterEviction(t *testing.T) {
+	c := New(time.Minute, 1, 1)
+	reservation := begin(t, c, "tx-1", false, nil)
+	begin(t, c, "tx-2", false, nil)
+	c.Finish(reservation, true)
+	begin(t, c, "tx-1", true, nil)
+}
+
+func TestCacheExpires(t *testing.T) {
+	c := New(10*time.Millisecond, 100, 1)
+	c.Finish(begin(t, c, "tx-1", false, nil), true)
+	time.Sleep(20 * time.Millisecond)
+	begin(t, c, "tx-1", false, nil)
+	// Зависшая публикация тоже освобождает ключ по TTL
+	time.Sleep(20 * time.Millisecond)
+	begin(t, c, "tx-1", false, nil)
+}
+
+// TestCacheStaleFinish проверяет, что поздний Finish первой публикации не трогает ключ,
+// который после истечения или вытеснения занял другой запрос
+func TestCacheStaleFinish(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache *Cache
+		// release освобождает ключ tx-1 первой публикации
+		release func(c *Cache)
+	}{
+		{
+			name:    "expired",
+			cache:   New(50*time.Millisecond, 100, 1),
+			release: func(*Cache) { time.Sleep(60 * time.Millisecond) },
+		},
+		{
+			name:  "evicted",
+			cache: New(time.Minute, 1, 1),
+			release: func(c *Cache) {
+				begin(t, c, "tx-2", false, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cache
+			first := begin(t, c, "tx-1", false, nil)
+			tt.release(c)
+			second := begin(t, c, "tx-1", false, nil)
+			c.Finish(first, false)
+			begin(t, c, "tx-1", false, ErrInFlight)
+			c.Finish(first, true)
+			begin(t, c, "tx-1", false, ErrInFlight)
+			c.Finish(second, true)
+			begin(t, c, "tx-1", true, nil)
+		})
+	}
+}
@@ -2,4 +2,10 @@ module github.com/ex10se/http-perf-test/go
 
 go 1.25
 
-require github.com/rabbitmq/amqp091-go v1.10.0
+require (
+	github.com/klauspost/compress v1.18.2
+	github.com/pierrec/lz4/v4 v4.1.31
+	github.com/rabbitmq/amqp091-go v1.10.0
+)
+
+require gopkg.in/yaml.v3 v3.0.1
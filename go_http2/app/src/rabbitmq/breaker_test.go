@@ -0,0 +1,175 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// breakerStep — действие над breaker и ожидаемый результат
+type breakerStep struct {
+	// advance сдвигает часы перед действием
+	advance time.Duration
+	// op — allow, check или record
+	op      string
+	results []error
+	wantErr bool
+	// wantRetryAfter проверяется, если не 0
+	wantRetryAfter time.Duration
+	wantState      int
+}
+
+func TestBreaker(t *testing.T) {
+	failed := []error{ErrUnavailable}
+	ok := []error{nil}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []breakerStep
+	}{
+		{
+			name:      "opens at threshold",
+			threshold: 2,
+			steps: []breakerStep{
+				{op: "allow", wantState: breakerClosed},
+				{op: "record", results: failed, wantState: breakerClosed},
+				{op: "record", results: failed, wantState: breakerOpen},
+				{op: "allow", wantErr: true, wantRetryAfter: 5 * time.Second, wantState: breakerOpen},
+				{advance: 2 * time.Second, op: "check", wantErr: true, wantRetryAfter: 3 * time.Second, wantState: breakerOpen},
+			},
+		},
+		{
+			name:      "success resets failures",
+			threshold: 2,
+			steps: []breakerStep{
+				{op: "record", results: failed, wantState: breakerClosed},
+				{op: "record", results: ok, wantState: breakerClosed},
+				{op: "record", results: failed, wantState: breakerClosed},
+			},
+		},
+		{
+			name:      "nack and blocked are not failures",
+			threshold: 1,
+			steps: []breakerStep{
+				{op: "record", results: []error{nil, ErrNacked}, wantState: breakerClosed},
+				{op: "record", results: []error{&BlockedError{}}, wantState: breakerClosed},
+				{op: "record", results: []error{context.Canceled}, wantState: breakerClosed},
+			},
+		},
+		{
+			name:      "cool down expires into half-open with one probe",
+			threshold: 1,
+			steps: []breakerStep{
+				{op: "record", results: failed, wantState: breakerOpen},
+				{advance: 4 * time.Second, op: "allow", wantErr: true, wantState: breakerOpen},
+				{advance: time.Second, op: "check", wantState: breakerOpen},
+				{op: "allow", wantState: breakerHalfOpen},
+				{op: "allow", wantErr: true, wantState: breakerHalfOpen},
+				{op: "record", results: ok, wantState: breakerClosed},
+				{op: "allow", wantState: breakerClosed},
+			},
+		},
+		{
+			name:      "failed probe reopens",
+			threshold: 1,
+			steps: []breakerStep{
+				{op: "record", results: failed, wantState: breakerOpen},
+				{advance: 5 * time.Second, op: "allow", wantState: breakerHalfOpen},
+				{op: "record", results: failed, wantState: breakerOpen},
+				{op: "allow", wantErr: true, wantRetryAfter: 5 * time.Second, wantState: breakerOpen},
+			},
+		},
+		{
+			name:      "cancelled probe returns to open and can be retried",
+			threshold: 1,
+			steps: []breakerStep{
+				{op: "record", results: failed, wantState: breakerOpen},
+				{advance: 5 * time.Second, op: "allow", wantState: breakerHalfOpen},
+				{op: "record", results: []error{context.DeadlineExceeded}, wantState: breakerOpen},
+				{op: "allow", wantState: breakerHalfOpen},
+			},
+		},
+		{
+			name:      "disabled",
+			threshold: 0,
+			steps: []breakerStep{
+				{op: "record", results: failed, wantState: breakerClosed},
+				{op: "record", results: failed, wantState: breakerClosed},
+				{op: "allow", wantState: breakerClosed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			b := &breaker{
+				opts: BreakerOptions{FailureThreshold: tt.threshold, CoolDown: 5 * time.Second},
+				now:  func() time.Time { return now },
+			}
+			for i, step := range tt.steps {
+				now = now.Add(step.advance)
+				var err error
+				switch step.op {
+				case "allow":
+					err = b.allow()
+				case "check":
+					err = b.check()
+				case "record":
+					b.record(step.results)
+				}
+				if (err != nil) != step.wantErr {
+					t.Fatalf("step %d %s: error = %v, wantErr %v", i, step.op, err, step.wantErr)
+				}
+				if err != nil && !errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("step %d %s: error = %v, want ErrCircuitOpen", i, step.op, err)
+				}
+				var openErr *CircuitOpenError
+				if step.wantRetryAfter != 0 && (!errors.As(err, &openErr) || openErr.RetryAfter != step.wantRetryAfter) {
+					t.Fatalf("step %d %s: error = %v, want retry after %v", i, step.op, err, step.wantRetryAfter)
+				}
+				if b.state != step.wantState {
+					t.Fatalf("step %d %s: state = %d, want %d", i, step.op, b.state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name            string
+		results         []error
+		failed, neutral bool
+	}{
+		{"success", []error{nil, nil}, false, false},
+		{"nack", []error{ErrNacked}, false, false},
+		{"unavailable", []error{nil, ErrUnavailable}, true, false},
+		{"cancelled", []error{context.Canceled}, false, true},
+		{"blocked", []error{&BlockedError{}}, false, true},
+		{"failure wins over cancel", []error{context.Canceled, ErrConfirmTimeout}, true, false},
+	}
+	for _, tt := range tests {
+		failed, neutral := classify(tt.results)
+		if failed != tt.failed || neutral != tt.neutral {
+			t.Errorf("%s: classify() = %v, %v; want %v, %v", tt.name, failed, neutral, tt.failed, tt.neutral)
+		}
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&CircuitOpenError{RetryAfter: 2500 * time.Millisecond}, "3"},
+		{&CircuitOpenError{}, "1"},
+		{&BlockedError{RetryAfter: 4 * time.Second}, "4"},
+		{ErrUnavailable, ""},
+	}
+	for _, tt := range tests {
+		if got := RetryAfterHeader(tt.err); got != tt.want {
+			t.Errorf("RetryAfterHeader(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
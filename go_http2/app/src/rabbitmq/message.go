@@ -0,0 +1,74 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ex10se/http-perf-test/go/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Message — сообщение для публикации в RabbitMQ
+// Свойства кроме RoutingKey и Body необязательны и попадают в AMQP свойства сообщения,
+// чтобы консьюмеры могли фильтровать и дедуплицировать сообщения не распаковывая тело
+type Message struct {
+	// Exchange — exchange для публикации, пусто — exchange топологии
+	Exchange   string
+	RoutingKey string
+	Body       []byte
+	// MessageID — txId события
+	MessageID string
+	// Type — состояние события
+	Type      string
+	Timestamp time.Time
+	// Priority — trackData.priority, nil — приоритет по умолчанию клиента
+	Priority *uint8
+	// Headers — channel и channel_id события
+	Headers amqp.Table
+}
+
+// NewMessage сериализует событие в JSON, выбирает маршрут через router
+// и заполняет свойства сообщения из полей события
+func NewMessage(event *models.StatusEvent, router *Router) (Message, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return Message{}, err
+	}
+	route := router.Route(event)
+	message := Message{
+		Exchange:   route.Exchange,
+		RoutingKey: route.key(event),
+		Body:       body,
+		MessageID:  event.TxID,
+		Type:       event.State,
+		Timestamp:  time.Now(),
+		Priority:   messagePriority(event),
+	}
+	if event.Channel != nil || event.ChannelID != nil {
+		message.Headers = amqp.Table{}
+		if event.Channel != nil {
+			message.Headers["channel"] = *event.Channel
+		}
+		if event.ChannelID != nil {
+			message.Headers["channel_id"] = *event.ChannelID
+		}
+	}
+	return message, nil
+}
+
+// messagePriority возвращает приоритет из trackData, ограниченный диапазоном AMQP 0..255
+func messagePriority(event *models.StatusEvent) *uint8 {
+	if event.TrackData == nil || event.TrackData.Priority == nil {
+		return nil
+	}
+	priority := uint8(min(max(*event.TrackData.Priority, 0), models.MaxPriority))
+	return &priority
+}
+
+// envelope — сообщение, подготовленное к публикации: сжатое тело и AMQP свойства.
+// В таком виде сообщения хранятся в спуле
+type envelope struct {
+	Exchange   string          `json:"exchange,omitempty"`
+	RoutingKey string          `json:"routing_key"`
+	Publishing amqp.Publishing `json:"publishing"`
+}
@@ -0,0 +1,242 @@
+package rabbitmq
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckRoutingDefaultTopology(t *testing.T) {
+	for _, shards := range []int{0, 1, 4} {
+		topology := DefaultTopology(QueueOptions{Shards: shards, DeadLetter: true})
+		if err := topology.CheckRouting(DefaultRouter(shards)); err != nil {
+			t.Errorf("shards=%d: %v", shards, err)
+		}
+	}
+	// Шардированный роутер не доходит до очередей топологии без шардов
+	if err := DefaultTopology(QueueOptions{}).CheckRouting(DefaultRouter(4)); err == nil {
+		t.Error("sharded router over unsharded topology: expected error")
+	}
+}
+
+func TestCheckRouting(t *testing.T) {
+	queues := []QueueSpec{{Name: "events"}, {Name: "errors"}}
+	tests := []struct {
+		name     string
+		topology Topology
+		router   *Router
+		wantErr  bool
+	}{
+		{
+			name: "direct",
+			topology: Topology{
+				Exchange:  "events",
+				Exchanges: []ExchangeSpec{{Name: "events", Type: "direct"}},
+				Queues:    queues,
+				Bindings:  []BindingSpec{{Queue: "events", Exchange: "events", RoutingKey: "events"}},
+			},
+			router: &Router{Default: &Route{RoutingKey: "events"}},
+		},
+		{
+			name: "direct without binding",
+			topology: Topology{
+				Exchange:  "events",
+				Exchanges: []ExchangeSpec{{Name: "events", Type: "direct"}},
+				Queues:    queues,
+				Bindings:  []BindingSpec{{Queue: "events", Exchange: "events", RoutingKey: "events"}},
+			},
+			router: &Router{
+				Rules:   []Rule{{Route: Route{RoutingKey: "errors"}}},
+				Default: &Route{RoutingKey: "events"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "topic",
+			topology: Topology{
+				Exchange:  "events",
+				Exchanges: []ExchangeSpec{{Name: "events", Type: "topic"}},
+				Queues:    queues,
+				Bindings:  []BindingSpec{{Queue: "events", Exchange: "events", RoutingKey: "status.#"}},
+			},
+			router: &Router{Default: &Route{RoutingKey: "status.go", Shards: 3}},
+		},
+		{
+			name: "topic without match",
+			topology: Topology{
+				Exchange:  "events",
+				Exchanges: []ExchangeSpec{{Name: "events", Type: "topic"}},
+				Queues:    queues,
+				Bindings:  []BindingSpec{{Queue: "events", Exchange: "events", RoutingKey: "status.*"}},
+			},
+			router:  &Router{Default: &Route{RoutingKey: "status.go", Shards: 3}},
+			wantErr: true,
+		},
+		{
+			name: "fanout",
+			topology: Topology{
+				Exchange:  "events",
+				Exchanges: []ExchangeSpec{{Name: "events", Type: "fanout"}},
+				Queues:    queues,
+				Bindings:  []BindingSpec{{Queue: "events", Exchange: "events"}},
+			},
+			router: &Router{Default: &Route{RoutingKey: "anything"}},
+		},
+		{
+			name:     "default exchange",
+			topology: Topology{Queues: queues},
+			router:   &Router{Default: &Route{RoutingKey: "errors"}},
+		},
+		{
+			name:     "default exchange without queue",
+			topology: Topology{Queues: queues},
+			router:   &Router{Default: &Route{RoutingKey: "missing"}},
+			wantErr:  true,
+		},
+		{
+			name: "alternate exchange",
+			topology: Topology{
+				Exchange: "events",
+				Exchanges: []ExchangeSpec{{
+					Name:      "events",
+					Type:      "direct",
+					Arguments: map[string]any{"alternate-exchange": "unrouted"},
+				}},
+				Queues: queues,
+			},
+			router: &Router{Default: &Route{RoutingKey: "events"}},
+		},
+		{
+			name: "route exchange",
+			topology: Topology{
+				Exchange:  "events",
+				Exchanges: []ExchangeSpec{{Name: "events", Type: "direct"}},
+				Queues:    queues,
+				Bindings:  []BindingSpec{{Queue: "errors", Exchange: "amq.direct", RoutingKey: "errors"}},
+			},
+			router: &Router{Default: &Route{Exchange: "amq.direct", RoutingKey: "errors"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.topology.CheckRouting(tt.router)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckRouting() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"status.go", "status.go", true},
+		{"status.*", "status.go", true},
+		{"status.*", "status.go.1", false},
+		{"status.#", "status", true},
+		{"status.#", "status.go.1", true},
+		{"#", "status.go", true},
+		{"*.go.#", "status.go.1", true},
+		{"*.go", "status.echo", false},
+	}
+	for _, tt := range tests {
+		got := topicMatches(strings.Split(tt.pattern, "."), strings.Split(tt.key, "."))
+		if got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadTopologyRejectsUnroutedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	data := `
+exchange: events
+exchanges:
+  - name: events
+    type: direct
+queues:
+  - name: events
+bindings:
+  - queue: events
+    exchange: events
+    routing_key: events
+routing:
+  rules:
+    - match: {has_error: true}
+      routing_key: errors
+  default:
+    routing_key: events
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadTopology(path)
+	if err == nil || !strings.Contains(err.Error(), `"errors"`) {
+		t.Fatalf("LoadTopology() error = %v, want unrouted key errors", err)
+	}
+}
+
+func TestDestinations(t *testing.T) {
+	topology := &Topology{
+		Exchange: "events",
+		Exchanges: []ExchangeSpec{
+			{Name: "events", Type: "topic"},
+			{Name: "headers", Type: "headers"},
+		},
+		Queues: []QueueSpec{{Name: "all"}, {Name: "go"}},
+		Bindings: []BindingSpec{
+			{Queue: "all", Exchange: "events", RoutingKey: "status.#"},
+			{Queue: "go", Exchange: "events", RoutingKey: "status.go"},
+			{Queue: "all", Exchange: "events", RoutingKey: "#"},
+		},
+	}
+	queues, known := topology.Destinations("events", "status.go")
+	if !known || !slices.Equal(queues, []string{"all", "go"}) {
+		t.Errorf("Destinations(events, status.go) = %v, %v; want [all go], true", queues, known)
+	}
+	if queues, known := topology.Destinations("", "go"); !known || !slices.Equal(queues, []string{"go"}) {
+		t.Errorf("Destinations(\"\", go) = %v, %v; want [go], true", queues, known)
+	}
+	if _, known := topology.Destinations("headers", "status.go"); known {
+		t.Error("Destinations(headers) is known, want unknown for headers exchange")
+	}
+}
+
+func TestValidateOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]any
+		wantErr bool
+	}{
+		{name: "no overflow", args: nil},
+		{name: "drop-head", args: map[string]any{"x-overflow": OverflowDropHead}},
+		{name: "reject-publish-dlx on classic", args: map[string]any{"x-overflow": OverflowRejectPublishDLX}},
+		{name: "reject-publish on quorum", args: map[string]any{"x-queue-type": QueueTypeQuorum, "x-overflow": OverflowRejectPublish}},
+		{name: "reject-publish-dlx on quorum", args: map[string]any{"x-queue-type": QueueTypeQuorum, "x-overflow": OverflowRejectPublishDLX}, wantErr: true},
+		{name: "overflow on stream", args: map[string]any{"x-queue-type": QueueTypeStream, "x-overflow": OverflowDropHead}, wantErr: true},
+		{name: "unknown value", args: map[string]any{"x-overflow": "drop-tail"}, wantErr: true},
+		{name: "not a string", args: map[string]any{"x-overflow": 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		topology := Topology{
+			Exchange:  "events",
+			Exchanges: []ExchangeSpec{{Name: "events", Type: "direct"}},
+			Queues:    []QueueSpec{{Name: "events", Arguments: tt.args}},
+		}
+		if err := topology.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+	// Топология по умолчанию проверяется так же: RABBITMQ_OVERFLOW и RABBITMQ_QUEUE_TYPE несовместимы
+	_, err := New(Options{
+		URLs:   []string{"amqp://localhost/"},
+		Queues: QueueOptions{Type: QueueTypeQuorum, MaxLength: 100, Overflow: OverflowRejectPublishDLX},
+	})
+	if err == nil || !strings.Contains(err.Error(), "quorum") {
+		t.Errorf("New() error = %v, want unsupported overflow", err)
+	}
+}